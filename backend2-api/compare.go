@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Modos de comparação aceitos em ?compare= em /api/metrics
+const (
+	comparePreviousPeriod = "previous_period" // período de mesmo tamanho imediatamente anterior
+	compareLastYear       = "last_year"       // mesmas datas no ano anterior
+	compareCustom         = "custom"          // compare_start e compare_end informados explicitamente
+)
+
+// Comparison traz as métricas do período de comparação e as variações em relação ao período pedido
+type Comparison struct {
+	Mode               string             `json:"mode"` // previous_period, last_year ou custom
+	StartDate          string             `json:"start_date"`
+	EndDate            string             `json:"end_date"`
+	FinancialMetrics   FinancialMetrics   `json:"financial_metrics"`
+	OperationalMetrics OperationalMetrics `json:"operational_metrics"`
+	KPIs               *KPIs              `json:"kpis,omitempty"` // presente apenas com ?kpis=true
+	Deltas             MetricsDeltas      `json:"deltas"`
+}
+
+// Delta é a variação de um campo: atual - comparação, e em percentual da comparação.
+// Percent é null quando o valor de comparação é zero (variação percentual indefinida).
+type Delta struct {
+	Absolute float64  `json:"absolute"`
+	Percent  *float64 `json:"percent"`
+}
+
+// MetricsDeltas tem a variação de cada campo, no mesmo formato da resposta de /api/metrics
+type MetricsDeltas struct {
+	FinancialMetrics struct {
+		ApprovedRevenue  Delta `json:"approved_revenue"`
+		PendingRevenue   Delta `json:"pending_revenue"`
+		CancelledRevenue Delta `json:"cancelled_revenue"`
+	} `json:"financial_metrics"`
+	OperationalMetrics struct {
+		ApprovedOrders  Delta `json:"approved_orders"`
+		PendingOrders   Delta `json:"pending_orders"`
+		CancelledOrders Delta `json:"cancelled_orders"`
+	} `json:"operational_metrics"`
+}
+
+// parseDateParam valida uma data YYYY-MM-DD recebida na query
+func parseDateParam(name, value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, fmt.Errorf("%s deve estar no formato YYYY-MM-DD", name)
+	}
+	return t, nil
+}
+
+// sameDayLastYear devolve a mesma data no ano anterior; 29 de fevereiro vira 28 de fevereiro
+func sameDayLastYear(t time.Time) time.Time {
+	last := t.AddDate(-1, 0, 0)
+	if last.Day() != t.Day() { // 29/02 normalizado para 01/03
+		last = last.AddDate(0, 0, -last.Day())
+	}
+	return last
+}
+
+// parseComparison lê o período de comparação de /api/metrics. Retorna nil se nenhum foi pedido.
+// previous_period e last_year exigem start_date e end_date, pois o período de comparação é derivado deles.
+func parseComparison(r *http.Request, startDate, endDate string) (*Comparison, error) {
+	q := r.URL.Query()
+	mode := q.Get("compare")
+	compareStart, compareEnd := q.Get("compare_start"), q.Get("compare_end")
+
+	if compareStart != "" || compareEnd != "" {
+		if mode != "" && mode != compareCustom {
+			return nil, fmt.Errorf("use compare ou compare_start/compare_end, não ambos")
+		}
+		if compareStart == "" || compareEnd == "" {
+			return nil, fmt.Errorf("compare_start e compare_end devem ser informados juntos")
+		}
+		start, err := parseDateParam("compare_start", compareStart)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseDateParam("compare_end", compareEnd)
+		if err != nil {
+			return nil, err
+		}
+		if end.Before(start) {
+			return nil, fmt.Errorf("compare_end deve ser igual ou posterior a compare_start")
+		}
+		return &Comparison{Mode: compareCustom, StartDate: compareStart, EndDate: compareEnd}, nil
+	}
+
+	switch mode {
+	case "":
+		return nil, nil // sem comparação
+	case comparePreviousPeriod, compareLastYear:
+	case compareCustom:
+		return nil, fmt.Errorf("compare=custom exige compare_start e compare_end")
+	default:
+		return nil, fmt.Errorf("compare deve ser previous_period ou last_year")
+	}
+
+	if startDate == "" || endDate == "" {
+		return nil, fmt.Errorf("compare=%s exige start_date e end_date", mode)
+	}
+	start, err := parseDateParam("start_date", startDate)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseDateParam("end_date", endDate)
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end_date deve ser igual ou posterior a start_date")
+	}
+
+	if mode == comparePreviousPeriod { // mesmo número de dias, terminando na véspera de start_date
+		days := int(end.Sub(start).Hours()/24) + 1
+		end = start.AddDate(0, 0, -1)
+		start = end.AddDate(0, 0, -(days - 1))
+	} else {
+		start, end = sameDayLastYear(start), sameDayLastYear(end)
+	}
+	return &Comparison{Mode: mode, StartDate: start.Format("2006-01-02"), EndDate: end.Format("2006-01-02")}, nil
+}
+
+// delta calcula a variação entre o valor atual e o de comparação, arredondada em centavos / 0,01%
+func delta(current, previous float64) Delta {
+	return Delta{
+		Absolute: round2(current - previous),
+		Percent:  percentOf(current-previous, previous), // mesma regra de divisão por zero dos KPIs
+	}
+}
+
+// round2 arredonda para duas casas decimais (evita resíduos de ponto flutuante como 0.30000000000000004)
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// compareMetrics calcula a variação de cada campo entre o período pedido e o de comparação
+func compareMetrics(current MetricsResponse, previous Comparison) MetricsDeltas {
+	var d MetricsDeltas
+	cf, pf := current.FinancialMetrics, previous.FinancialMetrics
+	d.FinancialMetrics.ApprovedRevenue = delta(cf.ApprovedRevenue, pf.ApprovedRevenue)
+	d.FinancialMetrics.PendingRevenue = delta(cf.PendingRevenue, pf.PendingRevenue)
+	d.FinancialMetrics.CancelledRevenue = delta(cf.CancelledRevenue, pf.CancelledRevenue)
+
+	co, po := current.OperationalMetrics, previous.OperationalMetrics
+	d.OperationalMetrics.ApprovedOrders = delta(float64(co.ApprovedOrders), float64(po.ApprovedOrders))
+	d.OperationalMetrics.PendingOrders = delta(float64(co.PendingOrders), float64(po.PendingOrders))
+	d.OperationalMetrics.CancelledOrders = delta(float64(co.CancelledOrders), float64(po.CancelledOrders))
+	return d
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseComparison(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		start     string
+		end       string
+		wantMode  string // vazio = sem comparação
+		wantStart string
+		wantEnd   string
+		wantErr   bool
+	}{
+		{"sem comparação", "", "2026-01-10", "2026-01-20", "", "", "", false},
+		{"período anterior", "compare=previous_period", "2026-01-10", "2026-01-20", comparePreviousPeriod, "2025-12-30", "2026-01-09", false},
+		{"período anterior de um dia", "compare=previous_period", "2026-03-01", "2026-03-01", comparePreviousPeriod, "2026-02-28", "2026-02-28", false},
+		{"ano anterior", "compare=last_year", "2026-01-10", "2026-01-20", compareLastYear, "2025-01-10", "2025-01-20", false},
+		{"ano anterior a partir de 29/02", "compare=last_year", "2028-02-29", "2028-03-01", compareLastYear, "2027-02-28", "2027-03-01", false},
+		{"personalizado", "compare_start=2025-06-01&compare_end=2025-06-30", "", "", compareCustom, "2025-06-01", "2025-06-30", false},
+		{"personalizado explícito", "compare=custom&compare_start=2025-06-01&compare_end=2025-06-30", "", "", compareCustom, "2025-06-01", "2025-06-30", false},
+		{"período anterior sem datas", "compare=previous_period", "", "2026-01-20", "", "", "", true},
+		{"modo desconhecido", "compare=yesterday", "2026-01-10", "2026-01-20", "", "", "", true},
+		{"custom sem datas", "compare=custom", "", "", "", "", "", true},
+		{"compare e compare_start juntos", "compare=last_year&compare_start=2025-06-01&compare_end=2025-06-30", "2026-01-10", "2026-01-20", "", "", "", true},
+		{"compare_end ausente", "compare_start=2025-06-01", "", "", "", "", "", true},
+		{"compare_end antes de compare_start", "compare_start=2025-06-30&compare_end=2025-06-01", "", "", "", "", "", true},
+		{"data fora do formato", "compare_start=01/06/2025&compare_end=2025-06-30", "", "", "", "", "", true},
+		{"end_date antes de start_date", "compare=previous_period", "2026-01-20", "2026-01-10", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/metrics?"+tt.query, nil)
+		got, err := parseComparison(r, tt.start, tt.end)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: erro = %v, esperado erro: %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if tt.wantMode == "" {
+			if got != nil {
+				t.Errorf("%s: comparação = %+v, esperado nil", tt.name, got)
+			}
+			continue
+		}
+		if got == nil || got.Mode != tt.wantMode || got.StartDate != tt.wantStart || got.EndDate != tt.wantEnd {
+			t.Errorf("%s: comparação = %+v, esperado %s de %s a %s", tt.name, got, tt.wantMode, tt.wantStart, tt.wantEnd)
+		}
+	}
+}
+
+func TestSameDayLastYear(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"2026-01-20", "2025-01-20"},
+		{"2028-02-29", "2027-02-28"},
+		{"2027-03-01", "2026-03-01"},
+	}
+	for _, tt := range tests {
+		in, _ := time.Parse("2006-01-02", tt.in)
+		if got := sameDayLastYear(in).Format("2006-01-02"); got != tt.want {
+			t.Errorf("sameDayLastYear(%s) = %s, esperado %s", tt.in, got, tt.want)
+		}
+	}
+}
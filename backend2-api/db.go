@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var db *sql.DB // pool de conexões compartilhado por todos os handlers, criado na inicialização
+
+// poolConfig define os limites do pool de conexões com o PostgreSQL
+type poolConfig struct {
+	MaxOpenConns    int           // máximo de conexões abertas (em uso + ociosas)
+	MaxIdleConns    int           // máximo de conexões ociosas mantidas para reuso
+	ConnMaxLifetime time.Duration // tempo máximo de vida de uma conexão, para renovar conexões antigas
+	ConnMaxIdleTime time.Duration // tempo máximo que uma conexão fica ociosa antes de ser fechada
+	QueryTimeout    time.Duration // tempo máximo de uma consulta feita por um handler
+}
+
+var defaultPoolConfig = poolConfig{
+	MaxOpenConns:    10,
+	MaxIdleConns:    5,
+	ConnMaxLifetime: 30 * time.Minute,
+	ConnMaxIdleTime: 5 * time.Minute,
+	QueryTimeout:    10 * time.Second,
+}
+
+var queryTimeout = defaultPoolConfig.QueryTimeout
+
+// retryAfterSeconds é sugerido ao cliente (header Retry-After) quando o banco está indisponível
+const retryAfterSeconds = "5"
+
+// loadPoolConfig lê os limites do pool das variáveis de ambiente, ex.: DB_MAX_OPEN_CONNS=20 DB_CONN_MAX_LIFETIME=1h
+func loadPoolConfig() (poolConfig, error) {
+	cfg := defaultPoolConfig
+
+	ints := map[string]*int{
+		"DB_MAX_OPEN_CONNS": &cfg.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS": &cfg.MaxIdleConns,
+	}
+	for name, target := range ints {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return cfg, fmt.Errorf("%s inválida: %q", name, v)
+			}
+			*target = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"DB_CONN_MAX_LIFETIME":  &cfg.ConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME": &cfg.ConnMaxIdleTime,
+		"DB_QUERY_TIMEOUT":      &cfg.QueryTimeout,
+	}
+	for name, target := range durations {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return cfg, fmt.Errorf("%s inválida: %q (use uma duração como 30s ou 5m)", name, v)
+			}
+			*target = d
+		}
+	}
+
+	if cfg.QueryTimeout == 0 {
+		return cfg, fmt.Errorf("DB_QUERY_TIMEOUT deve ser maior que zero")
+	}
+	// Com MaxOpenConns = 0 (sem limite), o database/sql não restringe as ociosas
+	if cfg.MaxOpenConns > 0 && cfg.MaxIdleConns > cfg.MaxOpenConns {
+		cfg.MaxIdleConns = cfg.MaxOpenConns
+	}
+	return cfg, nil
+}
+
+// openDB cria o pool de conexões com o PostgreSQL. Não exige que o banco esteja no ar:
+// o database/sql conecta sob demanda, então o serviço sobe mesmo com o banco indisponível
+// e passa a responder normalmente quando ele voltar.
+func openDB(cfg poolConfig) (*sql.DB, error) {
+	databaseURL := os.Getenv("DATABASE_URL") // lê DATABASE_URL
+	if databaseURL == "" {                   // se DATABASE_URL não estiver configurada (vazia)
+		return nil, errDBNotConfigured
+	}
+
+	// Adicionar sslmode=disable se não estiver presente
+	if !strings.Contains(databaseURL, "sslmode") {
+		if strings.Contains(databaseURL, "?") {
+			databaseURL += "&sslmode=disable"
+		} else {
+			databaseURL += "?sslmode=disable"
+		}
+	}
+
+	pool, err := sql.Open("postgres", databaseURL) // apenas valida a URL; nenhuma conexão é aberta aqui
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar pool de conexões: %w", err)
+	}
+
+	pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	pool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	pool.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return pool, nil
+}
+
+// errDBNotConfigured é retornado pelos handlers quando o pool não foi criado (DATABASE_URL vazia)
+var errDBNotConfigured = errors.New("DATABASE_URL não configurada")
+
+// queryContext limita a duração de uma consulta e a cancela se o cliente desistir da requisição
+func queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), queryTimeout)
+}
+
+// isUnavailable indica se o erro é de banco fora do ar ou inacessível (e não de consulta inválida
+// ou lenta), caso em que a requisição pode ser repetida mais tarde
+func isUnavailable(err error) bool {
+	if isTimeout(err) {
+		return false // consulta lenta não é indisponibilidade
+	}
+	if errors.Is(err, errDBNotConfigured) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) { // conexão recusada, DNS, timeout de rede
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "53", "57": // connection_exception, insufficient_resources, operator_intervention (ex.: banco reiniciando)
+			return true // query_canceled (57014) já foi tratado acima como timeout
+		}
+	}
+	return false
+}
+
+// isTimeout indica se a consulta foi interrompida por exceder DB_QUERY_TIMEOUT
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014" // query_canceled: o driver cancela a consulta quando o prazo acaba
+}
+
+// writeDBError responde com 504 se a consulta excedeu o tempo limite, com 503 e Retry-After se o banco
+// estiver indisponível, ou com 500 caso contrário
+func writeDBError(w http.ResponseWriter, message string, err error) {
+	if isTimeout(err) {
+		log.Printf("⚠️  Consulta excedeu o tempo limite de %s: %v", queryTimeout, err)
+		http.Error(w, fmt.Sprintf("%s: a consulta excedeu o tempo limite de %s", message, queryTimeout), http.StatusGatewayTimeout)
+		return
+	}
+	if isUnavailable(err) {
+		log.Printf("⚠️  Banco de dados indisponível: %v", err)
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		http.Error(w, "Banco de dados temporariamente indisponível, tente novamente em instantes", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusInternalServerError)
+}
+
+// PoolStats resume o estado do pool de conexões
+type PoolStats struct {
+	OpenConnections int   `json:"open_connections"`
+	InUse           int   `json:"in_use"`
+	Idle            int   `json:"idle"`
+	MaxOpen         int   `json:"max_open"`
+	WaitCount       int64 `json:"wait_count"` // requisições que esperaram por uma conexão livre
+	WaitDurationMs  int64 `json:"wait_duration_ms"`
+}
+
+// ReadyResponse representa a resposta do endpoint GET /ready
+type ReadyResponse struct {
+	Status   string     `json:"status"` // ready ou unavailable
+	Database string     `json:"database"`
+	Error    string     `json:"error,omitempty"`
+	Pool     *PoolStats `json:"pool,omitempty"`
+}
+
+// readyHandler verifica se o serviço consegue atender consultas, usando o pool compartilhado.
+// Diferente de /health (processo no ar), responde 503 enquanto o banco estiver indisponível.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := ReadyResponse{Status: "ready", Database: "up"}
+	err := errDBNotConfigured
+	if db != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second) // readiness deve responder rápido
+		defer cancel()
+		err = db.PingContext(ctx)
+
+		stats := db.Stats()
+		response.Pool = &PoolStats{
+			OpenConnections: stats.OpenConnections,
+			InUse:           stats.InUse,
+			Idle:            stats.Idle,
+			MaxOpen:         stats.MaxOpenConnections,
+			WaitCount:       stats.WaitCount,
+			WaitDurationMs:  stats.WaitDuration.Milliseconds(),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		response.Status = "unavailable"
+		response.Database = "down"
+		response.Error = err.Error()
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
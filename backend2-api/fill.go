@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Modos de preenchimento aceitos em ?fill= na série temporal
+const (
+	fillNone     = ""         // padrão: apenas os períodos com pedidos
+	fillZero     = "zero"     // períodos sem pedidos com receita e pedidos zerados
+	fillNull     = "null"     // períodos sem pedidos com métricas null (o gráfico interrompe a linha)
+	fillPrevious = "previous" // períodos sem pedidos repetem o último período com pedidos
+)
+
+// maxFillPoints limita quantos pontos o preenchimento pode gerar em uma resposta
+const maxFillPoints = 5000
+
+// MarshalJSON serializa o ponto normalmente, exceto os preenchidos com fill=null,
+// que mantêm date, period e filled e têm todas as métricas como null
+func (p TimeSeriesPoint) MarshalJSON() ([]byte, error) {
+	type point TimeSeriesPoint // mesmo formato, sem este método (evita recursão)
+	data, err := json.Marshal(point(p))
+	if err != nil || !p.null {
+		return data, err
+	}
+
+	// Reescreve o objeto campo a campo, preservando a ordem dos campos
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil { // {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for dec.More() {
+		name, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "date", "period", "filled":
+		default:
+			value = json.RawMessage("null")
+		}
+
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+// truncate leva um instante ao início do seu período no fuso pedido
+func (s seriesRequest) truncate(t time.Time) time.Time {
+	local := t.In(s.Location)
+	if s.Granularity == granularityHour {
+		// Volta os minutos locais sem reconstruir a hora: a 01:00 repetida no fim do horário de verão
+		// mantém o seu deslocamento (como o date_trunc por hora do PostgreSQL)
+		return t.Add(-time.Duration(local.Minute())*time.Minute - time.Duration(local.Second())*time.Second - time.Duration(local.Nanosecond()))
+	}
+
+	year, month, day := local.Date()
+	switch s.Granularity {
+	case granularityWeek:
+		day -= (int(local.Weekday()) + 6) % 7 // volta até a segunda-feira (semana ISO)
+	case granularityMonth:
+		day = 1
+	case granularityQuarter:
+		month, day = (month-1)/3*3+1, 1
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, s.Location)
+}
+
+// next devolve o início do período seguinte. Por hora, soma uma hora ao instante: horas puladas no
+// início do horário de verão não aparecem e as repetidas no fim aparecem duas vezes. Nas demais
+// granularidades a conta é feita no calendário local, então dias e meses não sofrem com a mudança.
+func (s seriesRequest) next(t time.Time) time.Time {
+	if s.Granularity == granularityHour {
+		return t.Add(time.Hour)
+	}
+
+	local := t.In(s.Location)
+	year, month, day := local.Date()
+	switch s.Granularity {
+	case granularityWeek:
+		day += 7
+	case granularityMonth:
+		month++
+	case granularityQuarter:
+		month += 3
+	default:
+		day++
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, s.Location)
+}
+
+// samePeriod indica se dois inícios de período são o mesmo: por hora, o mesmo instante; nas demais
+// granularidades, a mesma data local (uma meia-noite que não existe no fuso pode cair em instantes diferentes)
+func (s seriesRequest) samePeriod(a, b time.Time) bool {
+	if s.Granularity == granularityHour {
+		return a.Equal(b)
+	}
+	ya, ma, da := a.In(s.Location).Date()
+	yb, mb, db := b.In(s.Location).Date()
+	return ya == yb && ma == mb && da == db
+}
+
+// fillGaps devolve um ponto para cada período do intervalo pedido, preenchendo os que não têm pedidos
+// conforme s.Fill. buckets traz o início (instante) de cada ponto de points, em ordem.
+// Sem start_date ou end_date, o intervalo vai do primeiro ao último período com pedidos.
+func (s seriesRequest) fillGaps(points []TimeSeriesPoint, buckets []time.Time) ([]TimeSeriesPoint, error) {
+	var first, stop time.Time // stop é o início do primeiro período depois do intervalo
+	if !s.Start.IsZero() {
+		first = s.truncate(s.Start)
+	} else if len(buckets) > 0 {
+		first = s.truncate(buckets[0])
+	}
+	switch {
+	case !s.End.IsZero() && s.Granularity == granularityHour:
+		year, month, day := s.End.In(s.Location).Date()
+		stop = time.Date(year, month, day+1, 0, 0, 0, 0, s.Location) // end_date inclusivo: até a última hora do dia
+	case !s.End.IsZero():
+		stop = s.next(s.truncate(s.End))
+	case len(buckets) > 0:
+		stop = s.next(s.truncate(buckets[len(buckets)-1]))
+	}
+	if first.IsZero() || stop.IsZero() {
+		return points, nil // sem intervalo e sem pedidos, não há o que preencher
+	}
+
+	filled := []TimeSeriesPoint{}
+	var previous TimeSeriesPoint // último ponto com pedidos, usado por fill=previous
+	i := 0
+	for bucket := first; bucket.Before(stop); bucket = s.next(bucket) {
+		if len(filled) == maxFillPoints {
+			return nil, fmt.Errorf("o preenchimento geraria mais de %d pontos; reduza o intervalo ou use uma granularidade maior", maxFillPoints)
+		}
+
+		for i < len(buckets) && buckets[i].Before(bucket) && !s.samePeriod(buckets[i], bucket) { // não deveria ocorrer, mas evita travar a comparação
+			i++
+		}
+		if i < len(buckets) && s.samePeriod(buckets[i], bucket) { // período com pedidos
+			previous = points[i]
+			filled = append(filled, points[i])
+			i++
+			continue
+		}
+
+		var point TimeSeriesPoint // fill=zero: métricas zeradas
+		if s.Fill == fillPrevious {
+			point = previous // antes do primeiro período com pedidos, também zerado
+		}
+		point.Date, point.Period = s.labels(bucket)
+		point.Filled = true
+		point.null = s.Fill == fillNull
+		filled = append(filled, point)
+	}
+	return filled, nil
+}
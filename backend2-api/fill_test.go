@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seriesPoint monta um ponto com pedidos aprovados no início de período bucket
+func seriesPoint(s seriesRequest, bucket time.Time, orders int) TimeSeriesPoint {
+	p := TimeSeriesPoint{ApprovedOrders: orders, ApprovedRevenue: float64(orders) * 10}
+	p.Date, p.Period = s.labels(bucket)
+	return p
+}
+
+func TestFillGaps(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name    string
+		fill    string
+		start   time.Time
+		end     time.Time
+		buckets []time.Time
+		want    []int // pedidos aprovados de cada ponto; -1 = ponto preenchido com null
+	}{
+		{"zero no intervalo pedido", fillZero, day(1), day(5), []time.Time{day(2), day(4)}, []int{0, 1, 0, 2, 0}},
+		{"previous repete o último período", fillPrevious, day(1), day(5), []time.Time{day(2), day(4)}, []int{0, 1, 1, 2, 2}},
+		{"null", fillNull, day(1), day(3), []time.Time{day(2)}, []int{-1, 1, -1}},
+		{"sem limites vai do primeiro ao último", fillZero, time.Time{}, time.Time{}, []time.Time{day(3), day(6)}, []int{1, 0, 0, 2}},
+		{"sem limites e sem pedidos", fillZero, time.Time{}, time.Time{}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		s := seriesRequest{Granularity: granularityDay, Fill: tt.fill, Location: time.UTC, Start: tt.start, End: tt.end}
+		var points []TimeSeriesPoint
+		for i, b := range tt.buckets {
+			points = append(points, seriesPoint(s, b, i+1))
+		}
+
+		got, err := s.fillGaps(points, tt.buckets)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d pontos, esperado %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			switch {
+			case want == -1 && !got[i].null:
+				t.Errorf("%s: ponto %d deveria ser null", tt.name, i)
+			case want >= 0 && got[i].ApprovedOrders != want:
+				t.Errorf("%s: ponto %d com %d pedidos, esperado %d", tt.name, i, got[i].ApprovedOrders, want)
+			}
+		}
+	}
+}
+
+func TestFillGapsLabelsAndPeriods(t *testing.T) {
+	saoPaulo, _ := time.LoadLocation("America/Sao_Paulo")
+	s := seriesRequest{
+		Granularity: granularityMonth,
+		Fill:        fillZero,
+		Location:    saoPaulo,
+		Start:       time.Date(2025, 11, 15, 0, 0, 0, 0, saoPaulo),
+		End:         time.Date(2026, 2, 10, 0, 0, 0, 0, saoPaulo),
+	}
+	got, err := s.fillGaps(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2025-11", "2025-12", "2026-01", "2026-02"}
+	if len(got) != len(want) {
+		t.Fatalf("%d pontos, esperado %d", len(got), len(want))
+	}
+	for i, period := range want {
+		if got[i].Period != period || !got[i].Filled {
+			t.Errorf("ponto %d = %s (filled=%t), esperado %s preenchido", i, got[i].Period, got[i].Filled, period)
+		}
+	}
+}
+
+func TestFillGapsDaylightSaving(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	t.Run("fim do horário de verão tem 25 horas", func(t *testing.T) {
+		s := seriesRequest{Granularity: granularityHour, Fill: fillZero, Location: newYork}
+		s.Start = time.Date(2026, 11, 1, 0, 0, 0, 0, newYork)
+		s.End = s.Start
+
+		first := time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC)  // 01:00 EDT
+		second := time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC) // 01:00 EST
+		points := []TimeSeriesPoint{seriesPoint(s, first, 1), seriesPoint(s, second, 2)}
+
+		got, err := s.fillGaps(points, []time.Time{first, second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 25 {
+			t.Fatalf("%d pontos, esperado 25", len(got))
+		}
+		if got[1].ApprovedOrders != 1 || got[2].ApprovedOrders != 2 {
+			t.Errorf("as duas 01:00 foram unidas ou perdidas: %+v, %+v", got[1], got[2])
+		}
+		if got[1].Date == got[2].Date {
+			t.Errorf("as duas 01:00 têm o mesmo date: %s", got[1].Date)
+		}
+	})
+
+	t.Run("início do horário de verão tem 23 horas", func(t *testing.T) {
+		s := seriesRequest{Granularity: granularityHour, Fill: fillZero, Location: newYork}
+		s.Start = time.Date(2026, 3, 8, 0, 0, 0, 0, newYork)
+		s.End = s.Start
+
+		got, err := s.fillGaps(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 23 {
+			t.Fatalf("%d pontos, esperado 23", len(got))
+		}
+		for _, p := range got {
+			if strings.HasPrefix(p.Period, "2026-03-08T02:") {
+				t.Errorf("a hora pulada 02:00 foi gerada: %s", p.Date)
+			}
+		}
+	})
+
+	t.Run("dias não se deslocam na mudança de horário", func(t *testing.T) {
+		s := seriesRequest{Granularity: granularityDay, Fill: fillZero, Location: newYork}
+		s.Start = time.Date(2026, 3, 7, 0, 0, 0, 0, newYork)
+		s.End = time.Date(2026, 3, 9, 0, 0, 0, 0, newYork)
+
+		got, err := s.fillGaps(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"2026-03-07", "2026-03-08", "2026-03-09"}
+		if len(got) != len(want) {
+			t.Fatalf("%d pontos, esperado %d", len(got), len(want))
+		}
+		for i, date := range want {
+			if got[i].Date != date {
+				t.Errorf("ponto %d = %s, esperado %s", i, got[i].Date, date)
+			}
+		}
+	})
+}
+
+func TestFillGapsLimit(t *testing.T) {
+	s := seriesRequest{
+		Granularity: granularityDay,
+		Fill:        fillZero,
+		Location:    time.UTC,
+		Start:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:         time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if _, err := s.fillGaps(nil, nil); err == nil {
+		t.Errorf("fillGaps aceitou mais de %d pontos", maxFillPoints)
+	}
+}
+
+func TestFilledNullJSON(t *testing.T) {
+	p := TimeSeriesPoint{Date: "2026-01-20", Period: "2026-01-20", Filled: true, null: true}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"date":"2026-01-20","period":"2026-01-20","approved_revenue":null,"pending_revenue":null,"cancelled_revenue":null,` +
+		`"approved_orders":null,"pending_orders":null,"cancelled_orders":null,"filled":true}`
+	if string(data) != want {
+		t.Errorf("JSON = %s, esperado %s", data, want)
+	}
+}
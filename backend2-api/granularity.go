@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	_ "time/tzdata" // a imagem alpine não traz a base de fusos horários
+)
+
+// Granularidades aceitas em ?granularity= na série temporal
+const (
+	granularityHour    = "hour"    // a partir de raw_data.orders, apenas para intervalos curtos
+	granularityDay     = "day"     // padrão
+	granularityWeek    = "week"    // semana ISO (segunda a domingo)
+	granularityMonth   = "month"   // mês civil
+	granularityQuarter = "quarter" // trimestre civil
+)
+
+// granularityUnits mapeia a granularidade para a unidade do date_trunc do PostgreSQL
+// (também serve de lista de valores permitidos, já que a unidade é concatenada na query)
+var granularityUnits = map[string]string{
+	granularityHour:    "hour",
+	granularityDay:     "day",
+	granularityWeek:    "week", // o date_trunc do PostgreSQL já trunca para a segunda-feira da semana ISO
+	granularityMonth:   "month",
+	granularityQuarter: "quarter",
+}
+
+// maxHourlyDays limita o intervalo da série por hora, que é calculada sobre os pedidos brutos
+// (TIMESERIES_MAX_HOURLY_DAYS, padrão 7)
+var maxHourlyDays = 7
+
+// maxRawDays limita o intervalo das séries por dia, semana, mês ou trimestre em fuso diferente de UTC,
+// que também são calculadas sobre os pedidos brutos (TIMESERIES_MAX_RAW_DAYS, padrão 366)
+var maxRawDays = 366
+
+// defaultLocation é o fuso usado para datas e limites de mês quando ?tz= não é informado (API_TIMEZONE, padrão UTC).
+// Os pedidos são gravados em UTC, então aggregated.daily_metrics tem dias em UTC.
+var defaultLocation = time.UTC
+
+// loadSeriesConfig lê a configuração da série temporal das variáveis de ambiente
+func loadSeriesConfig() error {
+	limits := map[string]*int{
+		"TIMESERIES_MAX_HOURLY_DAYS": &maxHourlyDays,
+		"TIMESERIES_MAX_RAW_DAYS":    &maxRawDays,
+	}
+	for name, target := range limits {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("%s inválida: %q", name, v)
+			}
+			*target = n
+		}
+	}
+	if v := os.Getenv("API_TIMEZONE"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return fmt.Errorf("API_TIMEZONE inválida: %q", v)
+		}
+		defaultLocation = loc
+	}
+	return nil
+}
+
+// seriesRequest reúne os parâmetros da série temporal já validados
+type seriesRequest struct {
+	Filters
+	Granularity string
+	Fill        string // modo de preenchimento dos períodos sem pedidos (fill.go)
+	KPIs        bool   // inclui os indicadores derivados em cada ponto (kpi.go)
+	Location    *time.Location
+	Start, End  time.Time // datas locais (meia-noite no fuso Location); zero = sem limite
+}
+
+// parseSeriesRequest lê e valida os parâmetros de /api/metrics/time-series
+func parseSeriesRequest(r *http.Request) (seriesRequest, error) {
+	q := r.URL.Query()
+	s := seriesRequest{
+		Filters: Filters{
+			StartDate:     q.Get("start_date"),
+			EndDate:       q.Get("end_date"),
+			PaymentMethod: q.Get("payment_method"),
+		},
+		Granularity: granularityDay,
+		KPIs:        q.Get("kpis") == "true",
+		Location:    defaultLocation,
+	}
+
+	if v := q.Get("granularity"); v != "" {
+		if _, ok := granularityUnits[v]; !ok {
+			return s, fmt.Errorf("granularity deve ser hour, day, week, month ou quarter")
+		}
+		s.Granularity = v
+	}
+
+	switch v := q.Get("fill"); v {
+	case fillNone, fillZero, fillNull, fillPrevious:
+		s.Fill = v
+	default:
+		return s, fmt.Errorf("fill deve ser zero, null ou previous")
+	}
+
+	if v := q.Get("tz"); v != "" { // ex.: tz=America/Sao_Paulo
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return s, fmt.Errorf("tz inválido: %q", v)
+		}
+		s.Location = loc
+	}
+
+	var err error
+	if s.StartDate != "" {
+		if s.Start, err = time.ParseInLocation("2006-01-02", s.StartDate, s.Location); err != nil {
+			return s, fmt.Errorf("start_date deve estar no formato YYYY-MM-DD")
+		}
+	}
+	if s.EndDate != "" {
+		if s.End, err = time.ParseInLocation("2006-01-02", s.EndDate, s.Location); err != nil {
+			return s, fmt.Errorf("end_date deve estar no formato YYYY-MM-DD")
+		}
+	}
+	if !s.Start.IsZero() && !s.End.IsZero() && s.End.Before(s.Start) {
+		return s, fmt.Errorf("end_date deve ser igual ou posterior a start_date")
+	}
+
+	switch {
+	case s.Granularity == granularityHour: // a série por hora lê os pedidos brutos, então o intervalo precisa ser curto
+		if s.Start.IsZero() {
+			return s, fmt.Errorf("granularity=hour exige start_date")
+		}
+		if s.End.IsZero() {
+			s.End = s.Start // apenas o dia de start_date
+		}
+		if days := spanDays(s.Start, s.End); days > maxHourlyDays {
+			return s, fmt.Errorf("granularity=hour aceita intervalos de até %d dias (recebido: %d)", maxHourlyDays, days)
+		}
+	case s.fromRawOrders():
+		// Fora de UTC a série também lê os pedidos brutos. Para não percorrer a tabela inteira, um intervalo
+		// aberto é fechado em hoje (end_date) e em maxRawDays dias antes do fim (start_date); os limites
+		// aplicados voltam em filters na resposta
+		if s.End.IsZero() {
+			now := time.Now().In(s.Location)
+			s.End = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.Location)
+			if s.End.Before(s.Start) {
+				s.End = s.Start
+			}
+			s.EndDate = s.End.Format("2006-01-02")
+		}
+		if s.Start.IsZero() {
+			s.Start = s.End.AddDate(0, 0, -(maxRawDays - 1))
+			s.StartDate = s.Start.Format("2006-01-02")
+		}
+		if days := spanDays(s.Start, s.End); days > maxRawDays {
+			return s, fmt.Errorf("fora de UTC, a série aceita intervalos de até %d dias (recebido: %d)", maxRawDays, days)
+		}
+	}
+	return s, nil
+}
+
+// spanDays conta os dias de start a end, inclusive (datas à meia-noite no mesmo fuso)
+func spanDays(start, end time.Time) int {
+	return int(math.Round(end.Sub(start).Hours()/24)) + 1 // arredonda os dias de 23 e 25 horas do horário de verão
+}
+
+// fromRawOrders indica se a série precisa ser calculada sobre raw_data.orders: por hora, ou em um fuso
+// diferente de UTC, pois os dias de aggregated.daily_metrics não podem ser redistribuídos em outro fuso
+func (s seriesRequest) fromRawOrders() bool {
+	return s.Granularity == granularityHour || s.Location.String() != time.UTC.String()
+}
+
+// query monta a consulta da série temporal: um registro por período, com receita e pedidos por status
+func (s seriesRequest) query() (string, []interface{}) {
+	unit := granularityUnits[s.Granularity]
+	args := []interface{}{} // slice vazio para argumentos da query
+	argIndex := 1
+
+	var query string
+	if s.fromRawOrders() {
+		// created_at é gravado em UTC; o date_trunc com fuso trunca no horário local (horas, dias e meses
+		// começam na meia-noite do fuso pedido) e devolve o instante (timestamptz). Por hora, mantém o
+		// deslocamento original, então as duas 01:00 do fim do horário de verão continuam separadas.
+		args = append(args, s.Location.String())
+		argIndex++
+		query = `
+			SELECT
+				date_trunc('` + unit + `', created_at AT TIME ZONE 'UTC', $1) AS bucket,
+				SUM(CASE WHEN status = 'approved' THEN value ELSE 0 END) AS approved_revenue,
+				SUM(CASE WHEN status = 'pending' THEN value ELSE 0 END) AS pending_revenue,
+				SUM(CASE WHEN status = 'cancelled' THEN value ELSE 0 END) AS cancelled_revenue,
+				COUNT(*) FILTER (WHERE status = 'approved') AS approved_orders,
+				COUNT(*) FILTER (WHERE status = 'pending') AS pending_orders,
+				COUNT(*) FILTER (WHERE status = 'cancelled') AS cancelled_orders
+			FROM raw_data.orders
+			WHERE 1=1
+		`
+
+		// Limites convertidos de meia-noite local para UTC e comparados direto com created_at, para usar o
+		// índice orders_created_at_idx (criado pelo pipeline); parseSeriesRequest garante os dois limites
+		if !s.Start.IsZero() {
+			query += fmt.Sprintf(" AND created_at >= ($%d::timestamp AT TIME ZONE $1) AT TIME ZONE 'UTC'", argIndex)
+			args = append(args, s.StartDate)
+			argIndex++
+		}
+		if !s.End.IsZero() {
+			query += fmt.Sprintf(" AND created_at < (($%d::date + 1)::timestamp AT TIME ZONE $1) AT TIME ZONE 'UTC'", argIndex) // end_date inclusivo
+			args = append(args, s.End.Format("2006-01-02"))
+			argIndex++
+		}
+	} else {
+		// Dias já agregados; date_trunc sobre timestamp (sem fuso) para não depender do fuso da sessão
+		query = `
+			SELECT
+				date_trunc('` + unit + `', date::timestamp) AS bucket,
+				SUM(CASE WHEN status = 'approved' THEN total_value ELSE 0 END) AS approved_revenue,
+				SUM(CASE WHEN status = 'pending' THEN total_value ELSE 0 END) AS pending_revenue,
+				SUM(CASE WHEN status = 'cancelled' THEN total_value ELSE 0 END) AS cancelled_revenue,
+				SUM(CASE WHEN status = 'approved' THEN total_orders ELSE 0 END) AS approved_orders,
+				SUM(CASE WHEN status = 'pending' THEN total_orders ELSE 0 END) AS pending_orders,
+				SUM(CASE WHEN status = 'cancelled' THEN total_orders ELSE 0 END) AS cancelled_orders
+			FROM aggregated.daily_metrics
+			WHERE 1=1
+		`
+
+		if !s.Start.IsZero() {
+			query += fmt.Sprintf(" AND date >= $%d", argIndex)
+			args = append(args, s.StartDate)
+			argIndex++
+		}
+		if !s.End.IsZero() {
+			query += fmt.Sprintf(" AND date <= $%d", argIndex)
+			args = append(args, s.EndDate)
+			argIndex++
+		}
+	}
+
+	if s.PaymentMethod != "" {
+		query += fmt.Sprintf(" AND payment_method = $%d", argIndex)
+		args = append(args, s.PaymentMethod)
+	}
+
+	query += " GROUP BY bucket ORDER BY bucket" // um registro por período, em ordem cronológica
+	return query, args
+}
+
+// labels formata o início de um período: date (YYYY-MM-DD, ou RFC 3339 com o fuso na série por hora)
+// e period, o rótulo do período (2026-01-20, 2026-W04, 2026-01, 2026-Q1 ou 2026-01-20T13:00).
+// bucket é um instante; o horário local vem dele, e não de campos de data e hora, para que horas
+// repetidas no fim do horário de verão mantenham o deslocamento certo.
+func (s seriesRequest) labels(bucket time.Time) (string, string) {
+	local := bucket.In(s.Location)
+
+	switch s.Granularity {
+	case granularityHour:
+		return local.Format(time.RFC3339), local.Format("2006-01-02T15:04")
+	case granularityWeek:
+		year, week := local.ISOWeek() // a semana pertence ao ano ISO da sua quinta-feira
+		return local.Format("2006-01-02"), fmt.Sprintf("%d-W%02d", year, week)
+	case granularityMonth:
+		return local.Format("2006-01-02"), local.Format("2006-01")
+	case granularityQuarter:
+		return local.Format("2006-01-02"), fmt.Sprintf("%d-Q%d", local.Year(), (int(local.Month())-1)/3+1)
+	default:
+		return local.Format("2006-01-02"), local.Format("2006-01-02")
+	}
+}
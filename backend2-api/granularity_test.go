@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseSeriesRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		granularity string
+		tz          string
+		start, end  string // start_date e end_date depois da validação (vazio = sem limite)
+		wantErr     bool
+	}{
+		{"padrões", "", granularityDay, "UTC", "", "", false},
+		{"mês em UTC sem limites", "granularity=month", granularityMonth, "UTC", "", "", false},
+		{"intervalo em UTC", "start_date=2025-01-01&end_date=2026-06-30", granularityDay, "UTC", "2025-01-01", "2026-06-30", false},
+		{"granularidade desconhecida", "granularity=year", "", "", "", "", true},
+		{"fill desconhecido", "fill=linear", "", "", "", "", true},
+		{"fuso desconhecido", "tz=Marte/Olympus", "", "", "", "", true},
+		{"data fora do formato", "start_date=20/01/2026", "", "", "", "", true},
+		{"end_date antes de start_date", "start_date=2026-01-20&end_date=2026-01-10", "", "", "", "", true},
+
+		{"hora exige start_date", "granularity=hour", "", "", "", "", true},
+		{"hora sem end_date usa o dia de start_date", "granularity=hour&start_date=2026-01-20", granularityHour, "UTC", "2026-01-20", "2026-01-20", false},
+		{"hora no limite", "granularity=hour&start_date=2026-01-20&end_date=2026-01-26", granularityHour, "UTC", "2026-01-20", "2026-01-26", false},
+		{"hora acima do limite", "granularity=hour&start_date=2026-01-20&end_date=2026-01-27", "", "", "", "", true},
+		{"hora atravessando o horário de verão", "granularity=hour&tz=America/New_York&start_date=2026-03-05&end_date=2026-03-11", granularityHour, "America/New_York", "2026-03-05", "2026-03-11", false},
+
+		{"fuso fechado em um ano", "tz=America/Sao_Paulo&start_date=2025-01-01&end_date=2026-01-01", granularityDay, "America/Sao_Paulo", "2025-01-01", "2026-01-01", false},
+		{"fuso acima do limite", "tz=America/Sao_Paulo&start_date=2025-01-01&end_date=2026-01-02", "", "", "", "", true},
+		{"fuso sem start_date volta o limite de dias", "tz=America/Sao_Paulo&granularity=week&end_date=2026-01-20", granularityWeek, "America/Sao_Paulo", "2025-01-20", "2026-01-20", false},
+	}
+
+	for _, tt := range tests {
+		s, err := parseSeriesRequest(httptest.NewRequest("GET", "/api/metrics/time-series?"+tt.query, nil))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: erro = %v, esperado erro: %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if s.Granularity != tt.granularity || s.Location.String() != tt.tz || s.StartDate != tt.start {
+			t.Errorf("%s: granularity=%s tz=%s start_date=%q, esperado %s %s %q", tt.name, s.Granularity, s.Location, s.StartDate, tt.granularity, tt.tz, tt.start)
+		}
+		if end := dateOf(s.End); end != tt.end {
+			t.Errorf("%s: end = %q, esperado %q", tt.name, end, tt.end)
+		}
+	}
+}
+
+// Sem end_date, a série fora de UTC termina hoje e começa maxRawDays dias antes
+func TestParseSeriesRequestOpenRawRange(t *testing.T) {
+	s, err := parseSeriesRequest(httptest.NewRequest("GET", "/api/metrics/time-series?tz=America/Sao_Paulo", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().In(s.Location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.Location)
+	if s.EndDate != dateOf(today) || s.StartDate != dateOf(today.AddDate(0, 0, -(maxRawDays-1))) {
+		t.Errorf("intervalo = %s a %s, esperado os %d dias até %s", s.StartDate, s.EndDate, maxRawDays, dateOf(today))
+	}
+	if !s.fromRawOrders() {
+		t.Error("série fora de UTC deveria ler raw_data.orders")
+	}
+}
+
+func TestSeriesLabels(t *testing.T) {
+	saoPaulo, _ := time.LoadLocation("America/Sao_Paulo")
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	tests := []struct {
+		granularity string
+		location    *time.Location
+		bucket      time.Time
+		date        string
+		period      string
+	}{
+		{granularityDay, time.UTC, time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC), "2026-01-20", "2026-01-20"},
+		{granularityWeek, time.UTC, time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC), "2026-01-19", "2026-W04"},
+		{granularityWeek, time.UTC, time.Date(2025, 12, 29, 0, 0, 0, 0, time.UTC), "2025-12-29", "2026-W01"}, // ano ISO da quinta-feira
+		{granularityMonth, saoPaulo, time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC), "2026-01-01", "2026-01"},
+		{granularityQuarter, saoPaulo, time.Date(2026, 4, 1, 3, 0, 0, 0, time.UTC), "2026-04-01", "2026-Q2"},
+		{granularityHour, saoPaulo, time.Date(2026, 1, 20, 16, 0, 0, 0, time.UTC), "2026-01-20T13:00:00-03:00", "2026-01-20T13:00"},
+		// As duas 01:00 do fim do horário de verão mantêm cada uma o seu deslocamento
+		{granularityHour, newYork, time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC), "2026-11-01T01:00:00-04:00", "2026-11-01T01:00"},
+		{granularityHour, newYork, time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC), "2026-11-01T01:00:00-05:00", "2026-11-01T01:00"},
+	}
+
+	for _, tt := range tests {
+		s := seriesRequest{Granularity: tt.granularity, Location: tt.location}
+		date, period := s.labels(tt.bucket)
+		if date != tt.date || period != tt.period {
+			t.Errorf("labels(%s, %s, %s) = (%s, %s), esperado (%s, %s)", tt.granularity, tt.location, tt.bucket, date, period, tt.date, tt.period)
+		}
+	}
+}
+
+// dateOf formata uma data local, ou vazio para o tempo zero
+func dateOf(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
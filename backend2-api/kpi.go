@@ -0,0 +1,57 @@
+package main
+
+// KPIs são indicadores derivados das somas e contagens por status (?kpis=true).
+// Toda divisão por zero resulta em null: sem pedidos no denominador, o indicador é indefinido (e não zero).
+type KPIs struct {
+	AverageOrderValue AverageOrderValue `json:"average_order_value"` // ticket médio por status
+	ApprovalRate      *float64          `json:"approval_rate"`       // % dos pedidos aprovados
+	CancellationRate  *float64          `json:"cancellation_rate"`   // % dos pedidos cancelados
+	PendingShare      *float64          `json:"pending_share"`       // % dos pedidos pendentes
+}
+
+// AverageOrderValue é a receita dividida pelo número de pedidos de cada status
+type AverageOrderValue struct {
+	Approved  *float64 `json:"approved"`
+	Pending   *float64 `json:"pending"`
+	Cancelled *float64 `json:"cancelled"`
+}
+
+// divide calcula num / den * scale, arredondado em duas casas; nil quando den é zero
+func divide(num, den, scale float64) *float64 {
+	if den == 0 {
+		return nil
+	}
+	v := round2(num / den * scale)
+	return &v
+}
+
+// percentOf calcula part como percentual de whole; nil quando whole é zero
+func percentOf(part, whole float64) *float64 {
+	return divide(part, whole, 100)
+}
+
+// computeKPIs calcula os indicadores derivados a partir das métricas financeiras e operacionais.
+// As taxas usam como base o total de pedidos dos três status.
+func computeKPIs(f FinancialMetrics, o OperationalMetrics) *KPIs {
+	approved, pending, cancelled := float64(o.ApprovedOrders), float64(o.PendingOrders), float64(o.CancelledOrders)
+	total := approved + pending + cancelled
+
+	return &KPIs{
+		AverageOrderValue: AverageOrderValue{
+			Approved:  divide(f.ApprovedRevenue, approved, 1),
+			Pending:   divide(f.PendingRevenue, pending, 1),
+			Cancelled: divide(f.CancelledRevenue, cancelled, 1),
+		},
+		ApprovalRate:     percentOf(approved, total),
+		CancellationRate: percentOf(cancelled, total),
+		PendingShare:     percentOf(pending, total),
+	}
+}
+
+// kpis calcula os indicadores derivados de um ponto da série temporal
+func (p TimeSeriesPoint) kpis() *KPIs {
+	return computeKPIs(
+		FinancialMetrics{ApprovedRevenue: p.ApprovedRevenue, PendingRevenue: p.PendingRevenue, CancelledRevenue: p.CancelledRevenue},
+		OperationalMetrics{ApprovedOrders: p.ApprovedOrders, PendingOrders: p.PendingOrders, CancelledOrders: p.CancelledOrders},
+	)
+}
@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+// value compara um indicador opcional: want nil exige nil
+func value(t *testing.T, name string, got, want *float64) {
+	t.Helper()
+	switch {
+	case want == nil && got != nil:
+		t.Errorf("%s = %v, esperado null", name, *got)
+	case want != nil && got == nil:
+		t.Errorf("%s = null, esperado %v", name, *want)
+	case want != nil && *got != *want:
+		t.Errorf("%s = %v, esperado %v", name, *got, *want)
+	}
+}
+
+func ptr(v float64) *float64 { return &v }
+
+func TestComputeKPIs(t *testing.T) {
+	tests := []struct {
+		name        string
+		financial   FinancialMetrics
+		operational OperationalMetrics
+		want        KPIs
+	}{
+		{
+			name:        "todos os status",
+			financial:   FinancialMetrics{ApprovedRevenue: 1000, PendingRevenue: 300, CancelledRevenue: 100},
+			operational: OperationalMetrics{ApprovedOrders: 8, PendingOrders: 3, CancelledOrders: 1},
+			want: KPIs{
+				AverageOrderValue: AverageOrderValue{Approved: ptr(125), Pending: ptr(100), Cancelled: ptr(100)},
+				ApprovalRate:      ptr(66.67),
+				CancellationRate:  ptr(8.33),
+				PendingShare:      ptr(25),
+			},
+		},
+		{
+			name:        "status sem pedidos tem ticket médio null",
+			financial:   FinancialMetrics{ApprovedRevenue: 199.9},
+			operational: OperationalMetrics{ApprovedOrders: 3},
+			want: KPIs{
+				AverageOrderValue: AverageOrderValue{Approved: ptr(66.63)},
+				ApprovalRate:      ptr(100),
+				CancellationRate:  ptr(0),
+				PendingShare:      ptr(0),
+			},
+		},
+		{
+			name: "sem pedidos, tudo null",
+			want: KPIs{},
+		},
+	}
+
+	for _, tt := range tests {
+		got := computeKPIs(tt.financial, tt.operational)
+		value(t, tt.name+": ticket médio aprovado", got.AverageOrderValue.Approved, tt.want.AverageOrderValue.Approved)
+		value(t, tt.name+": ticket médio pendente", got.AverageOrderValue.Pending, tt.want.AverageOrderValue.Pending)
+		value(t, tt.name+": ticket médio cancelado", got.AverageOrderValue.Cancelled, tt.want.AverageOrderValue.Cancelled)
+		value(t, tt.name+": taxa de aprovação", got.ApprovalRate, tt.want.ApprovalRate)
+		value(t, tt.name+": taxa de cancelamento", got.CancellationRate, tt.want.CancellationRate)
+		value(t, tt.name+": participação pendente", got.PendingShare, tt.want.PendingShare)
+	}
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		name              string
+		current, previous float64
+		want              Delta
+	}{
+		{"aumento", 150, 100, Delta{Absolute: 50, Percent: ptr(50)}},
+		{"queda", 0.3, 0.6, Delta{Absolute: -0.3, Percent: ptr(-50)}},
+		{"sem variação", 10, 10, Delta{Absolute: 0, Percent: ptr(0)}},
+		{"comparação zerada", 25, 0, Delta{Absolute: 25}}, // percentual indefinido
+	}
+
+	for _, tt := range tests {
+		got := delta(tt.current, tt.previous)
+		if got.Absolute != tt.want.Absolute {
+			t.Errorf("%s: absolute = %v, esperado %v", tt.name, got.Absolute, tt.want.Absolute)
+		}
+		value(t, tt.name+": percent", got.Percent, tt.want.Percent)
+	}
+}
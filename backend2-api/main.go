@@ -1,7 +1,7 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -18,8 +18,11 @@ import (
 
 type MetricsResponse struct {
 	Filters            Filters            `json:"filters"`
+	Timezone           string             `json:"timezone"` // sempre UTC: os totais vêm dos dias UTC de aggregated.daily_metrics
 	FinancialMetrics   FinancialMetrics   `json:"financial_metrics"`
 	OperationalMetrics OperationalMetrics `json:"operational_metrics"`
+	KPIs               *KPIs              `json:"kpis,omitempty"`       // presente apenas com ?kpis=true
+	Comparison         *Comparison        `json:"comparison,omitempty"` // presente apenas com ?compare= ou ?compare_start=
 }
 
 type Filters struct {
@@ -41,18 +44,26 @@ type OperationalMetrics struct { // estrutura métricas operacionais
 }
 
 type TimeSeriesResponse struct { // estrutura série temporal
-	Filters Filters           `json:"filters"`
-	Data    []TimeSeriesPoint `json:"data"`
+	Filters     Filters           `json:"filters"`
+	Granularity string            `json:"granularity"` // hour, day, week, month ou quarter
+	Timezone    string            `json:"timezone"`
+	Fill        string            `json:"fill,omitempty"` // zero, null ou previous
+	Data        []TimeSeriesPoint `json:"data"`
 }
 
-type TimeSeriesPoint struct { // estrutura para um ponto (dia) da série temporal
-	Date             string  `json:"date"`
+type TimeSeriesPoint struct { // estrutura para um ponto (período) da série temporal
+	Date             string  `json:"date"`   // início do período
+	Period           string  `json:"period"` // rótulo do período, ex.: 2026-W04, 2026-01, 2026-Q1
 	ApprovedRevenue  float64 `json:"approved_revenue"`
 	PendingRevenue   float64 `json:"pending_revenue"`
 	CancelledRevenue float64 `json:"cancelled_revenue"`
 	ApprovedOrders   int     `json:"approved_orders"`
 	PendingOrders    int     `json:"pending_orders"`
 	CancelledOrders  int     `json:"cancelled_orders"`
+	KPIs             *KPIs   `json:"kpis,omitempty"`   // presente apenas com ?kpis=true
+	Filled           bool    `json:"filled,omitempty"` // período sem pedidos, gerado por ?fill=
+
+	null bool // preenchido com fill=null: métricas serializadas como null
 }
 
 var jwtSecret string // variável global para a chave JWT
@@ -65,9 +76,37 @@ func main() {
 		log.Println("⚠️  JWT_SECRET não configurada, usando valor padrão")
 	}
 
+	// Série temporal, ex.: API_TIMEZONE=America/Sao_Paulo TIMESERIES_MAX_HOURLY_DAYS=7
+	if err := loadSeriesConfig(); err != nil {
+		log.Fatalf("Configuração da série temporal inválida: %v", err)
+	}
+
+	// Pool de conexões compartilhado, ex.: DB_MAX_OPEN_CONNS=20 DB_MAX_IDLE_CONNS=10 DB_CONN_MAX_LIFETIME=30m
+	cfg, err := loadPoolConfig()
+	if err != nil {
+		log.Fatalf("Configuração do pool inválida: %v", err)
+	}
+	queryTimeout = cfg.QueryTimeout
+	if db, err = openDB(cfg); err != nil {
+		log.Printf("⚠️  %v, consultas responderão 503 até a configuração ser corrigida", err) // o serviço sobe mesmo assim (ex.: deploy antes do banco)
+	} else {
+		defer db.Close()
+		fmt.Printf("Pool de conexões: até %d abertas, %d ociosas, vida máxima %s, ociosidade máxima %s\n",
+			cfg.MaxOpenConns, cfg.MaxIdleConns, cfg.ConnMaxLifetime, cfg.ConnMaxIdleTime)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := db.PingContext(ctx); err != nil { // apenas avisa: o pool reconecta quando o banco voltar
+			log.Printf("⚠️  Banco de dados indisponível na inicialização: %v", err)
+		} else {
+			fmt.Println("✅ Conectado ao PostgreSQL")
+		}
+		cancel()
+	}
+
 	// Configurar rotas para expor endpoints
 	http.HandleFunc("/", corsMiddleware(helloHandler)) // todas são protegidas pelo CORS
 	http.HandleFunc("/health", corsMiddleware(healthHandler))
+	http.HandleFunc("/ready", corsMiddleware(readyHandler))                                               // prontidão: consegue consultar o banco?
 	http.HandleFunc("/api/metrics", corsMiddleware(verifyTokenMiddleware(metricsHandler)))                // métricas são protegidas pelo JWT
 	http.HandleFunc("/api/metrics/time-series", corsMiddleware(verifyTokenMiddleware(timeSeriesHandler))) // séries temporais também
 
@@ -152,33 +191,6 @@ func healthHandler(w http.ResponseWriter, r *http.Request) { // define o handler
 	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"}) // cria um mapa com status e codifica o json
 }
 
-func getDB() (*sql.DB, error) { // função que abre e retorna uma conexão com o PostgreSQL ou erro
-	databaseURL := os.Getenv("DATABASE_URL") // lê DATABASE_URL
-	if databaseURL == "" {                   // se DATABASE_URL não estiver configurada (vazia)
-		return nil, fmt.Errorf("DATABASE_URL não configurada")
-	}
-
-	// Adicionar sslmode=disable se não estiver presente
-	if !strings.Contains(databaseURL, "sslmode") {
-		if strings.Contains(databaseURL, "?") {
-			databaseURL += "&sslmode=disable"
-		} else {
-			databaseURL += "?sslmode=disable"
-		}
-	}
-
-	db, err := sql.Open("postgres", databaseURL) // abre uma conexão com o PostgreSQL
-	if err != nil {                              // se houver erro ao abrir a conexão
-		return nil, err
-	}
-
-	if err := db.Ping(); err != nil {
-		return nil, err
-	}
-
-	return db, nil
-}
-
 // metricsHandler retorna métricas agregadas (valores totais)
 func metricsHandler(w http.ResponseWriter, r *http.Request) { // define o handler para a rota /api/metrics, endpoint retorna métricas agregadas (valores totais)
 	if r.Method != http.MethodGet { // se o método não for GET
@@ -190,14 +202,67 @@ func metricsHandler(w http.ResponseWriter, r *http.Request) { // define o handle
 	startDate := r.URL.Query().Get("start_date")         // pega o valor do parâmetro start_date da URL
 	endDate := r.URL.Query().Get("end_date")             // pega o valor do parâmetro end_date
 	paymentMethod := r.URL.Query().Get("payment_method") // pega o valor do parâmetro payment_method
+	withKPIs := r.URL.Query().Get("kpis") == "true"      // inclui ticket médio e taxas calculados no servidor
+
+	// Período de comparação (?compare=previous_period|last_year ou ?compare_start=&compare_end=)
+	comparison, err := parseComparison(r, startDate, endDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Conectar ao banco
-	db, err := getDB() // abre uma conexão com o PostgreSQL
-	if err != nil {    // se houver erro ao abrir a conexão
-		http.Error(w, fmt.Sprintf("Erro ao conectar ao banco: %v", err), http.StatusInternalServerError)
+	if db == nil { // DATABASE_URL não configurada
+		writeDBError(w, "Erro ao conectar ao banco", errDBNotConfigured)
 		return
 	}
-	defer db.Close()
+
+	// Inicializar métricas
+	metrics := MetricsResponse{ // cria uma estrutura para a resposta com os filtros e métricas
+		Filters: Filters{
+			StartDate:     startDate,
+			EndDate:       endDate,
+			PaymentMethod: paymentMethod,
+		},
+		// Diferente da série temporal, o resumo não aceita ?tz= nem usa API_TIMEZONE: em outro fuso,
+		// os totais podem divergir da série nos pedidos feitos perto da meia-noite
+		Timezone: time.UTC.String(),
+	}
+
+	// Consultar as métricas do período pedido usando uma conexão do pool
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	metrics.FinancialMetrics, metrics.OperationalMetrics, err = queryMetrics(ctx, metrics.Filters)
+	if err != nil {
+		writeDBError(w, "Erro ao consultar métricas", err) // 503 se o banco estiver fora do ar
+		return
+	}
+	if withKPIs {
+		metrics.KPIs = computeKPIs(metrics.FinancialMetrics, metrics.OperationalMetrics)
+	}
+
+	// Mesmas métricas no período de comparação, com as variações de cada campo
+	if comparison != nil {
+		compareFilters := Filters{StartDate: comparison.StartDate, EndDate: comparison.EndDate, PaymentMethod: paymentMethod}
+		comparison.FinancialMetrics, comparison.OperationalMetrics, err = queryMetrics(ctx, compareFilters)
+		if err != nil {
+			writeDBError(w, "Erro ao consultar métricas do período de comparação", err)
+			return
+		}
+		if withKPIs {
+			comparison.KPIs = computeKPIs(comparison.FinancialMetrics, comparison.OperationalMetrics)
+		}
+		comparison.Deltas = compareMetrics(metrics, *comparison)
+		metrics.Comparison = comparison
+	}
+
+	w.Header().Set("Content-Type", "application/json") // define o header content-type como json
+	json.NewEncoder(w).Encode(metrics)                 // codifica as métricas em json e escreve na resposta, que é enviada para o frontend
+}
+
+// queryMetrics soma receita e pedidos por status em aggregated.daily_metrics, aplicando os filtros
+func queryMetrics(ctx context.Context, f Filters) (FinancialMetrics, OperationalMetrics, error) {
+	var financial FinancialMetrics
+	var operational OperationalMetrics
 
 	// Construir query base. query é uma instrução enviada ao banco de dados.
 	query := `
@@ -213,45 +278,33 @@ func metricsHandler(w http.ResponseWriter, r *http.Request) { // define o handle
 	argIndex := 1
 
 	// Adicionar filtros
-	if startDate != "" { // se startDate não estiver vazio
+	if f.StartDate != "" { // se a data inicial não estiver vazia
 		query += fmt.Sprintf(" AND date >= $%d", argIndex) // adiciona o filtro de data inicial à query
-		args = append(args, startDate)                     // adiciona o valor de startDate ao slice de argumentos
+		args = append(args, f.StartDate)                   // adiciona o valor de startDate ao slice de argumentos
 		argIndex++
 	}
 
-	if endDate != "" {
+	if f.EndDate != "" {
 		query += fmt.Sprintf(" AND date <= $%d", argIndex) // adiciona o filtro de data final à query
-		args = append(args, endDate)                       // adiciona o valor de endDate ao slice de argumentos
+		args = append(args, f.EndDate)                     // adiciona o valor de endDate ao slice de argumentos
 		argIndex++
 	}
 
-	if paymentMethod != "" {
+	if f.PaymentMethod != "" {
 		query += fmt.Sprintf(" AND payment_method = $%d", argIndex) // adiciona o filtro de método de pagamento à query
-		args = append(args, paymentMethod)                          // adiciona o valor de paymentMethod ao slice de argumentos
+		args = append(args, f.PaymentMethod)                        // adiciona o valor de paymentMethod ao slice de argumentos
 		argIndex++
 	}
 
 	query += " GROUP BY status" // agrupa os resultados por status
 
 	// Executar query
-	rows, err := db.Query(query, args...) // executa a query
+	rows, err := db.QueryContext(ctx, query, args...) // executa a query
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Erro ao executar query: %v", err), http.StatusInternalServerError)
-		return
+		return financial, operational, fmt.Errorf("erro ao executar query: %w", err)
 	}
 	defer rows.Close()
 
-	// Inicializar métricas
-	metrics := MetricsResponse{ // cria uma estrutura para a resposta com os filtros e métricas
-		Filters: Filters{
-			StartDate:     startDate,
-			EndDate:       endDate,
-			PaymentMethod: paymentMethod,
-		},
-		FinancialMetrics:   FinancialMetrics{},
-		OperationalMetrics: OperationalMetrics{},
-	}
-
 	// Processar resultados
 	for rows.Next() {
 		var status string
@@ -259,25 +312,26 @@ func metricsHandler(w http.ResponseWriter, r *http.Request) { // define o handle
 		var totalValue float64
 
 		if err := rows.Scan(&status, &totalOrders, &totalValue); err != nil { // se houver erro ao ler os resultados
-			http.Error(w, fmt.Sprintf("Erro ao ler resultado: %v", err), http.StatusInternalServerError)
-			return
+			return financial, operational, fmt.Errorf("erro ao ler resultado: %w", err)
 		}
 
 		switch status { // atribui os valores das métricas a cada status
 		case "approved":
-			metrics.FinancialMetrics.ApprovedRevenue = totalValue
-			metrics.OperationalMetrics.ApprovedOrders = totalOrders
+			financial.ApprovedRevenue = totalValue
+			operational.ApprovedOrders = totalOrders
 		case "pending":
-			metrics.FinancialMetrics.PendingRevenue = totalValue
-			metrics.OperationalMetrics.PendingOrders = totalOrders
+			financial.PendingRevenue = totalValue
+			operational.PendingOrders = totalOrders
 		case "cancelled":
-			metrics.FinancialMetrics.CancelledRevenue = totalValue
-			metrics.OperationalMetrics.CancelledOrders = totalOrders
+			financial.CancelledRevenue = totalValue
+			operational.CancelledOrders = totalOrders
 		}
 	}
+	if err := rows.Err(); err != nil { // a conexão pode cair no meio da leitura
+		return financial, operational, fmt.Errorf("erro ao ler resultado: %w", err)
+	}
+	return financial, operational, nil
 
-	w.Header().Set("Content-Type", "application/json") // define o header content-type como json
-	json.NewEncoder(w).Encode(metrics)                 // codifica as métricas em json e escreve na resposta, que é enviada para o frontend
 }
 
 // timeSeriesHandler retorna séries temporais para gráficos
@@ -287,73 +341,40 @@ func timeSeriesHandler(w http.ResponseWriter, r *http.Request) { // função que
 		return
 	}
 
-	// Obter parâmetros de query
-	startDate := r.URL.Query().Get("start_date") // pega o valor do parâmetro start_date
-	endDate := r.URL.Query().Get("end_date")
-	paymentMethod := r.URL.Query().Get("payment_method")
-
-	// Conectar ao banco
-	db, err := getDB()
+	// Obter e validar parâmetros de query (filtros, granularidade e fuso)
+	series, err := parseSeriesRequest(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Erro ao conectar ao banco: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer db.Close()
-
-	// Construir query para séries temporais
-	query := `
-		SELECT 
-			date,
-			SUM(CASE WHEN status = 'approved' THEN total_value ELSE 0 END) as approved_revenue, -- soma o total de valor para os pedidos aprovados, se não for aprovado é 0
-			SUM(CASE WHEN status = 'pending' THEN total_value ELSE 0 END) as pending_revenue,
-			SUM(CASE WHEN status = 'cancelled' THEN total_value ELSE 0 END) as cancelled_revenue,
-			SUM(CASE WHEN status = 'approved' THEN total_orders ELSE 0 END) as approved_orders,
-			SUM(CASE WHEN status = 'pending' THEN total_orders ELSE 0 END) as pending_orders,
-			SUM(CASE WHEN status = 'cancelled' THEN total_orders ELSE 0 END) as cancelled_orders
-		FROM aggregated.daily_metrics
-		WHERE 1=1
-	`
-
-	args := []interface{}{} // slice vazio para argumentos da query
-	argIndex := 1
 
-	// Adicionar filtros
-	if startDate != "" { // se startDate não estiver vazio
-		query += fmt.Sprintf(" AND date >= $%d", argIndex) // adiciona o filtro de data inicial à query
-		args = append(args, startDate)                     // adiciona o valor de startDate ao slice de argumentos
-		argIndex++
-	}
-
-	if endDate != "" {
-		query += fmt.Sprintf(" AND date <= $%d", argIndex) // adiciona o filtro de data final à query
-		args = append(args, endDate)                       // adiciona o valor de endDate ao slice de argumentos
-		argIndex++
-	}
-
-	if paymentMethod != "" {
-		query += fmt.Sprintf(" AND payment_method = $%d", argIndex) // adiciona o filtro de método de pagamento à query
-		args = append(args, paymentMethod)                          // adiciona o valor de paymentMethod ao slice de argumentos
-		argIndex++
+	if db == nil {
+		writeDBError(w, "Erro ao conectar ao banco", errDBNotConfigured)
+		return
 	}
 
-	query += " GROUP BY date ORDER BY date" // agrupa os resultados por data e ordena por data
+	// Construir query para séries temporais: um registro por período da granularidade pedida
+	query, args := series.query()
 
-	// Executar query
-	rows, err := db.Query(query, args...) // executa a query com os argumentos
+	// Executar query usando uma conexão do pool
+	ctx, cancel := queryContext(r)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, args...) // executa a query com os argumentos
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Erro ao executar query: %v", err), http.StatusInternalServerError)
+		writeDBError(w, "Erro ao executar query", err) // 503 se o banco estiver fora do ar
 		return
 	}
 	defer rows.Close()
 
 	// Processar resultados
 	var timeSeries []TimeSeriesPoint // slice vazio para os resultados da série temporal
+	var buckets []time.Time          // início de cada ponto, usado no preenchimento de períodos sem pedidos
 	for rows.Next() {
-		var point TimeSeriesPoint // variável para armazenar os pontos (dias) da série temporal
-		var date time.Time        // cria uma variável para a data
+		var point TimeSeriesPoint // variável para armazenar os pontos (períodos) da série temporal
+		var bucket time.Time      // cria uma variável para o início do período
 
 		err := rows.Scan( // lê os resultados da query
-			&date,                  // data
+			&bucket,                // início do período
 			&point.ApprovedRevenue, // lê a receita aprovada e armazena no ponto
 			&point.PendingRevenue,
 			&point.CancelledRevenue,
@@ -366,18 +387,37 @@ func timeSeriesHandler(w http.ResponseWriter, r *http.Request) { // função que
 			return
 		}
 
-		point.Date = date.Format("2006-01-02") // formata a data no formato YYYY-MM-DD
-		timeSeries = append(timeSeries, point) // adiciona o ponto à série temporal
+		point.Date, point.Period = series.labels(bucket) // formata o início (YYYY-MM-DD) e o rótulo do período
+		timeSeries = append(timeSeries, point)           // adiciona o ponto à série temporal
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil { // a conexão pode cair no meio da leitura
+		writeDBError(w, "Erro ao ler resultado", err)
+		return
+	}
+
+	// Gerar um ponto para cada período do intervalo, inclusive os sem pedidos
+	if series.Fill != fillNone {
+		if timeSeries, err = series.fillGaps(timeSeries, buckets); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Indicadores derivados de cada ponto, calculados depois do preenchimento para valer também nos períodos gerados
+	if series.KPIs {
+		for i := range timeSeries {
+			timeSeries[i].KPIs = timeSeries[i].kpis()
+		}
 	}
 
 	// Criar resposta com filtros
 	response := TimeSeriesResponse{ // cria uma estrutura para a resposta com os filtros e os pontos da série temporal
-		Filters: Filters{
-			StartDate:     startDate,     // data inicial
-			EndDate:       endDate,       // data final
-			PaymentMethod: paymentMethod, // método de pagamento
-		},
-		Data: timeSeries, // pontos da série temporal
+		Filters:     series.Filters,           // data inicial, data final e método de pagamento
+		Granularity: series.Granularity,       // granularidade dos pontos
+		Timezone:    series.Location.String(), // fuso usado para os limites dos períodos
+		Fill:        series.Fill,              // preenchimento dos períodos sem pedidos
+		Data:        timeSeries,               // pontos da série temporal
 	}
 
 	w.Header().Set("Content-Type", "application/json")
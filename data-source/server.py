@@ -1,4 +1,5 @@
-from flask import Flask, jsonify
+from flask import Flask, jsonify, request, url_for
+from datetime import datetime, timezone
 import csv
 import os
 
@@ -29,12 +30,67 @@ def read_orders(): # Função que lê o arquivo CSV e retorna os dados como list
     
     return orders
 
+def parse_timestamp(value): # Converte um timestamp ISO 8601 (aceitando o sufixo Z) para datetime
+    parsed = datetime.fromisoformat(value.replace('Z', '+00:00'))
+    if parsed.tzinfo is None: # sem fuso, assume UTC (como os pedidos são gravados) para poder comparar
+        parsed = parsed.replace(tzinfo=timezone.utc)
+    return parsed
+
+def created_since(order, since_dt): # created_at >= since; created_at inválido é mantido, como no filterSince do pipeline
+    """Indica se o pedido entra no filtro ?since=; a validação do pipeline rejeita os inválidos com o motivo"""
+    try:
+        return parse_timestamp(order['created_at']) >= since_dt
+    except (ValueError, TypeError, AttributeError): # formato inválido ou coluna vazia
+        return True
+
+def paginate(orders): # Aplica ?limit= com ?page=, ?offset= ou ?cursor=; sem limit, retorna todos os pedidos
+    """Retorna (corpo, link da próxima página) conforme os parâmetros de paginação"""
+    limit = request.args.get('limit', type=int)
+    if not limit or limit <= 0:
+        return orders, None
+
+    cursor = request.args.get('cursor')
+    if cursor is not None:
+        start = max(int(cursor or 0), 0) # o cursor é a posição do próximo pedido
+    elif 'page' in request.args:
+        start = (max(request.args.get('page', 1, type=int), 1) - 1) * limit # page começa em 1
+    else:
+        start = max(request.args.get('offset', 0, type=int), 0)
+
+    end = start + limit
+    chunk = orders[start:end]
+
+    next_link = None
+    if end < len(orders): # a próxima página usa cursor, preservando os demais filtros
+        args = {k: v for k, v in request.args.items() if k not in ('page', 'offset', 'cursor')}
+        next_link = url_for('get_orders', cursor=str(end), **args)
+
+    if cursor is not None: # quem pagina por cursor recebe um objeto com o próximo cursor
+        return {'orders': chunk, 'next_cursor': str(end) if next_link else None, 'next': next_link}, next_link
+    return chunk, next_link
+
 @app.route('/') # Endpoint GET que retorna todos os pedidos do CSV
 def get_orders(): # Função que retorna todos os pedidos do CSV
-    """Endpoint GET que retorna todos os pedidos do CSV"""
+    """Endpoint GET que retorna todos os pedidos do CSV (?since=<ISO 8601> filtra por created_at >= since,
+    ?limit=N com ?page=, ?offset= ou ?cursor= pagina o resultado)"""
     try:
         orders = read_orders() # chama a função read_orders para ler o arquivo CSV
-        return jsonify(orders), 200 # retorna os dados como JSON
+
+        since = request.args.get('since') # usado pelo pipeline na carga incremental
+        if since:
+            try:
+                since_dt = parse_timestamp(since)
+            except ValueError:
+                return jsonify({'error': f'since inválido: {since}'}), 400
+            orders = [o for o in orders if created_since(o, since_dt)]
+
+        try:
+            body, next_link = paginate(orders)
+        except ValueError:
+            return jsonify({'error': f'cursor inválido: {request.args.get("cursor")}'}), 400
+
+        headers = {'Link': f'<{next_link}>; rel="next"'} if next_link else {} # próxima página também no cabeçalho Link
+        return jsonify(body), 200, headers # retorna os dados como JSON
     except Exception as e:
         return jsonify({'error': str(e)}), 500
 
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// Modos de agregação aceitos em PIPELINE_AGGREGATION
+const (
+	aggregationTransformer = "transformer" // chama o serviço transformer via HTTP (padrão)
+	aggregationNative      = "native"      // o próprio pipeline agrega em aggregated.daily_metrics
+)
+
+var aggregationMode = aggregationTransformer
+
+// fullAggregation força a reconstrução completa de daily_metrics em toda execução (PIPELINE_FULL_AGGREGATION=true)
+var fullAggregation bool
+
+// setupAggregationStateTable cria a tabela com a linha única que registra se alguma agregação falhou ou
+// ficou pendente, caso em que as métricas podem estar desatualizadas fora dos grupos tocados pela próxima
+// execução. Fica no banco para sobreviver a reinícios e valer para todas as réplicas do pipeline.
+// A linha começa marcada: agregações podem ter falhado antes de a tabela existir.
+func setupAggregationStateTable(db *sql.DB) error {
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS pipeline.aggregation_state (
+			id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id), -- garante uma única linha
+			stale BOOLEAN NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("erro ao criar tabela pipeline.aggregation_state: %w", err)
+	}
+	if _, err := db.Exec("INSERT INTO pipeline.aggregation_state (stale) VALUES (TRUE) ON CONFLICT (id) DO NOTHING"); err != nil {
+		return fmt.Errorf("erro ao inicializar pipeline.aggregation_state: %w", err)
+	}
+	return nil
+}
+
+// aggregationStale indica se a próxima agregação precisa ser completa. Na dúvida (erro ao ler), responde
+// que sim: reconstruir tudo é mais lento, mas nunca deixa grupos desatualizados.
+func aggregationStale() bool {
+	var stale bool
+	if err := db.QueryRow("SELECT stale FROM pipeline.aggregation_state").Scan(&stale); err != nil {
+		log.Printf("⚠️  Erro ao ler o estado da agregação, usando reconstrução completa: %v", err)
+		return true
+	}
+	return stale
+}
+
+// setAggregationStale é o único ponto que marca (falha ou pendência) e limpa (reconstrução completa
+// bem-sucedida) o estado da agregação
+func setAggregationStale(stale bool) {
+	_, err := db.Exec("UPDATE pipeline.aggregation_state SET stale = $1, updated_at = CURRENT_TIMESTAMP", stale)
+	if err != nil {
+		log.Printf("⚠️  Erro ao gravar o estado da agregação: %v", err)
+	}
+}
+
+// aggregationKey identifica um grupo de aggregated.daily_metrics
+type aggregationKey struct {
+	Date          string `json:"date"` // YYYY-MM-DD
+	Status        string `json:"status"`
+	PaymentMethod string `json:"payment_method"`
+}
+
+// aggregationScope decide o que a agregação de uma execução recalcula: apenas os grupos tocados
+// ou, se nil, todas as métricas (forçado por configuração ou após falha/pendência anterior)
+func aggregationScope(touched map[aggregationKey]bool) []aggregationKey {
+	if fullAggregation || aggregationStale() {
+		return nil
+	}
+
+	keys := make([]aggregationKey, 0, len(touched))
+	for key := range touched {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { // ordem estável, a mesma de inserção do transformer
+		a, b := keys[i], keys[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Status != b.Status {
+			return a.Status < b.Status
+		}
+		return a.PaymentMethod < b.PaymentMethod
+	})
+	return keys
+}
+
+// aggregate executa a etapa de agregação no modo configurado e retorna o número de tentativas feitas.
+// Com keys nil reconstrói todo daily_metrics; caso contrário recalcula apenas os grupos informados.
+func aggregate(keys []aggregationKey) (int, error) {
+	if aggregationMode == aggregationNative {
+		groups, err := aggregateNative(db, keys)
+		if err != nil {
+			return 1, err
+		}
+		fmt.Printf("📊 %d grupos agregados em aggregated.daily_metrics\n", groups)
+		return 1, nil
+	}
+	return callTransformer(transformerURL, keys)
+}
+
+// setupAggregatedTable cria o schema aggregated e a tabela daily_metrics com a mesma definição do transformer
+func setupAggregatedTable(tx *sql.Tx) error {
+	if _, err := tx.Exec("CREATE SCHEMA IF NOT EXISTS aggregated"); err != nil {
+		return fmt.Errorf("erro ao criar schema aggregated: %w", err)
+	}
+
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS aggregated.daily_metrics (
+			id SERIAL PRIMARY KEY,
+			date DATE NOT NULL,
+			status VARCHAR(50) NOT NULL,
+			payment_method VARCHAR(50) NOT NULL,
+			total_orders INTEGER NOT NULL,
+			total_value NUMERIC(10, 2) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(date, status, payment_method)
+		)
+	`
+	if _, err := tx.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("erro ao criar tabela aggregated.daily_metrics: %w", err)
+	}
+	return nil
+}
+
+// aggregateNative faz no banco a mesma agregação do transformer/transform.py:
+// agrupa raw_data.orders por data, status e payment_method, atualiza aggregated.daily_metrics
+// e remove os grupos que deixaram de ter pedidos. Tudo em uma transação, então o backend2-api
+// nunca vê as métricas pela metade. Com keys diferente de nil, só esses grupos são recalculados.
+// Retorna o número de grupos gravados.
+func aggregateNative(db *sql.DB, keys []aggregationKey) (int64, error) {
+	// Filtro dos grupos tocados; os grupos chegam como JSON em $1
+	orderScope, metricScope := "", ""
+	var args []interface{}
+	if keys != nil {
+		payload, err := json.Marshal(keys)
+		if err != nil {
+			return 0, fmt.Errorf("erro ao serializar grupos: %w", err)
+		}
+		groups := "(SELECT date, status, payment_method FROM json_to_recordset($1::json) AS k(date DATE, status TEXT, payment_method TEXT))"
+		orderScope = "WHERE (DATE(created_at), status, payment_method) IN " + groups
+		metricScope = "AND (d.date, d.status, d.payment_method) IN " + groups
+		args = append(args, string(payload))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("erro ao iniciar transação: %w", err)
+	}
+	defer tx.Rollback() // sem efeito após o commit
+
+	if err := setupAggregatedTable(tx); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO aggregated.daily_metrics (date, status, payment_method, total_orders, total_value)
+		SELECT
+			DATE(created_at) AS date,
+			status,
+			payment_method,
+			COUNT(*) AS total_orders,
+			SUM(value) AS total_value
+		FROM raw_data.orders
+		`+orderScope+`
+		GROUP BY DATE(created_at), status, payment_method
+		ORDER BY date, status, payment_method -- mesma ordem de inserção do transformer
+		ON CONFLICT (date, status, payment_method) DO UPDATE SET
+			total_orders = EXCLUDED.total_orders,
+			total_value = EXCLUDED.total_value,
+			created_at = CURRENT_TIMESTAMP
+	`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao agregar pedidos: %w", err)
+	}
+	groups, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// Remover grupos que deixaram de existir (ex.: pedido que passou de pending para approved no modo upsert)
+	if _, err := tx.Exec(`
+		DELETE FROM aggregated.daily_metrics d
+		WHERE NOT EXISTS (
+			SELECT 1 FROM raw_data.orders o
+			WHERE DATE(o.created_at) = d.date
+			  AND o.status = d.status
+			  AND o.payment_method = d.payment_method
+		)
+		`+metricScope+`
+	`, args...); err != nil {
+		return 0, fmt.Errorf("erro ao remover grupos sem pedidos: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("erro ao confirmar transação: %w", err)
+	}
+	return groups, nil
+}
+
+// AggregateResponse representa a resposta do endpoint POST /aggregate
+type AggregateResponse struct {
+	Success  bool   `json:"success"`
+	Mode     string `json:"mode"`
+	Attempts int    `json:"attempts"`
+	Resolved int64  `json:"resolved"` // execuções com agregação pendente atualizadas
+	Error    string `json:"error,omitempty"`
+}
+
+// aggregateHandler reconstrói todo aggregated.daily_metrics sob demanda (POST /aggregate),
+// sem ingerir pedidos. Útil após correções manuais em raw_data.orders.
+func aggregateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Println("\n=== Reconstrução completa da agregação disparada via HTTP ===")
+
+	native := aggregationMode == aggregationNative
+	if !native && !transformerBreaker.allow() {
+		http.Error(w, "Circuito do transformer aberto, tente novamente mais tarde", http.StatusServiceUnavailable)
+		return
+	}
+
+	response := AggregateResponse{Mode: aggregationMode}
+	attempts, err := aggregate(nil)
+	response.Attempts = attempts
+	if err != nil {
+		log.Printf("⚠️  Erro na agregação: %v", err)
+		if !native {
+			transformerBreaker.failure()
+		}
+		setAggregationStale(true)
+		response.Error = err.Error()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if !native {
+		transformerBreaker.success()
+	}
+	setAggregationStale(false)
+	response.Success = true
+
+	if response.Resolved, err = resolvePendingAggregation(db); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	fmt.Println("✅ Agregação completa executada com sucesso")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
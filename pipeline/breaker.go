@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Estados do circuit breaker
+const (
+	breakerClosed   = "closed"    // chamadas normais
+	breakerOpen     = "open"      // chamadas puladas até o fim da espera
+	breakerHalfOpen = "half_open" // uma única chamada de teste decide se o circuito fecha ou reabre
+)
+
+// BreakerStatus representa o estado do circuit breaker exposto em /health
+type BreakerStatus struct {
+	State    string `json:"state"`
+	Failures int    `json:"consecutive_failures"`
+	OpenedAt string `json:"opened_at,omitempty"`
+	RetryAt  string `json:"retry_at,omitempty"` // quando o circuito passa a aceitar uma chamada de teste
+}
+
+// circuitBreaker evita chamar uma dependência que está falhando repetidamente
+type circuitBreaker struct {
+	threshold  int           // falhas consecutivas que abrem o circuito
+	cooldown   time.Duration // tempo aberto antes de permitir uma chamada de teste
+	onHalfOpen func()        // chamada quando a espera termina, em uma goroutine própria
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// PIPELINE_TRANSFORMER_BREAKER_THRESHOLD e PIPELINE_TRANSFORMER_BREAKER_COOLDOWN
+var transformerBreaker = &circuitBreaker{threshold: 3, cooldown: time.Minute, state: breakerClosed}
+
+// allow informa se a chamada pode ser feita. Com o circuito aberto e a espera encerrada,
+// passa para semiaberto e libera apenas esta chamada como teste.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	default: // semiaberto: já existe uma chamada de teste em andamento
+		return false
+	}
+}
+
+// success fecha o circuito
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != breakerClosed {
+		log.Printf("✅ Circuito do transformer fechado")
+	}
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+// failure contabiliza uma falha; abre o circuito ao atingir o limite ou se a chamada de teste falhar
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		log.Printf("⛔ Circuito do transformer aberto após %d falhas consecutivas, nova tentativa em %s", b.failures, b.cooldown)
+		if b.onHalfOpen != nil {
+			time.AfterFunc(b.cooldown, b.onHalfOpen)
+		}
+	}
+}
+
+// Status retorna uma cópia do estado atual
+func (b *circuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.state != breakerClosed {
+		status.OpenedAt = b.openedAt.Format(time.RFC3339)
+		status.RetryAt = b.openedAt.Add(b.cooldown).Format(time.RFC3339)
+	}
+	return status
+}
+
+// retryPendingAggregation é chamada quando a espera do circuito termina: se houver execuções com
+// agregação pendente, faz a chamada de teste e, com sucesso, marca essas execuções como agregadas.
+// Sem pendências, o circuito continua aberto e a próxima execução faz o teste.
+func retryPendingAggregation() {
+	pending, err := countPendingAggregation(db)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return
+	}
+	if pending == 0 {
+		return
+	}
+	if !transformerBreaker.allow() {
+		return // uma execução do pipeline já está fazendo a chamada de teste
+	}
+
+	fmt.Printf("\n🔄 Circuito do transformer semiaberto, refazendo a agregação de %d execuções pendentes...\n", pending)
+	if _, err := callTransformer(transformerURL, nil); err != nil { // reconstrução completa: cobre todas as execuções pendentes
+		log.Printf("⚠️  Agregação pendente falhou novamente: %v", err)
+		transformerBreaker.failure() // reabre e agenda nova tentativa
+		return
+	}
+	transformerBreaker.success()
+	setAggregationStale(false)
+
+	resolved, err := resolvePendingAggregation(db)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return
+	}
+	fmt.Printf("✅ Agregação pendente concluída (%d execuções atualizadas)\n", resolved)
+}
+
+// countPendingAggregation conta as execuções cuja agregação foi pulada com o circuito aberto
+func countPendingAggregation(db *sql.DB) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM pipeline.runs WHERE transformer_status = $1", transformerPending).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao contar agregações pendentes: %w", err)
+	}
+	return n, nil
+}
+
+// resolvePendingAggregation marca como agregadas as execuções pendentes.
+// Uma chamada ao transformer recalcula todas as métricas, então resolve todas as pendências de uma vez.
+func resolvePendingAggregation(db *sql.DB) (int64, error) {
+	res, err := db.Exec(
+		"UPDATE pipeline.runs SET transformer_status = $1, transformer_error = NULL WHERE transformer_status = $2",
+		transformerSucceeded, transformerPending,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao atualizar agregações pendentes: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Tipos de fonte aceitos em PIPELINE_SOURCE
+const (
+	sourceHTTP   = "http"   // API JSON do Data Source (padrão)
+	sourceCSV    = "csv"    // arquivo CSV local, no formato de PIPELINE_CSV_* (padrão: o de orders.csv)
+	sourceNDJSON = "ndjson" // arquivo com um pedido JSON por linha
+	sourceDir    = "dir"    // diretório com arquivos .csv, .ndjson e .jsonl
+)
+
+// connector é uma fonte de pedidos para o pipeline
+type connector interface {
+	// Name identifica a fonte; é a chave do watermark em pipeline.watermarks
+	Name() string
+	// Fetch entrega a emit, em lotes, os pedidos com created_at >= since (todos, se since for zero).
+	// Se emit retornar erro, a leitura é interrompida e o erro é devolvido.
+	// progress, se informado, é chamado a cada lote, página, arquivo ou tentativa com os totais acumulados.
+	Fetch(since time.Time, emit func([]Order) error, progress func(fetchProgress)) error
+}
+
+var source connector // configurada em main a partir de PIPELINE_SOURCE
+
+// fetchProgress são os totais acumulados de uma busca, informados ao longo da leitura da fonte
+type fetchProgress struct {
+	Pages    int // páginas (ou arquivos) lidas
+	Orders   int // pedidos recebidos
+	Attempts int // requisições HTTP feitas, incluindo novas tentativas (0 para arquivos locais)
+}
+
+// newConnector cria o conector do tipo informado.
+// Para http, location é a URL; para os demais, o caminho do arquivo ou diretório.
+func newConnector(kind, location string) (connector, error) {
+	switch kind {
+	case "", sourceHTTP:
+		return httpConnector{url: location, pagination: pagination}, nil
+	case sourceCSV, sourceNDJSON, sourceDir:
+		if location == "" {
+			return nil, fmt.Errorf("PIPELINE_SOURCE_PATH é obrigatória para a fonte %s", kind)
+		}
+		info, err := os.Stat(location)
+		if err != nil {
+			return nil, fmt.Errorf("fonte %s inacessível: %w", kind, err)
+		}
+		if (kind == sourceDir) != info.IsDir() {
+			return nil, fmt.Errorf("fonte %s não combina com %s", kind, location)
+		}
+		switch kind {
+		case sourceCSV:
+			return fileConnector{kind: kind, path: location, parse: csvDefaultFormat.parse}, nil
+		case sourceNDJSON:
+			return fileConnector{kind: kind, path: location, parse: parseOrdersNDJSON}, nil
+		default:
+			return dirConnector{path: location}, nil
+		}
+	default:
+		return nil, fmt.Errorf("PIPELINE_SOURCE desconhecida: %q (use http, csv, ndjson ou dir)", kind)
+	}
+}
+
+// httpConnector busca os pedidos na API JSON do Data Source; o filtro since é feito pela própria fonte.
+// Com PIPELINE_PAGINATION configurada, percorre as páginas até o fim.
+type httpConnector struct {
+	url        string
+	pagination paginationConfig
+}
+
+// sourceTransport é compartilhado por todas as buscas no Data Source, para reaproveitar as conexões
+// entre execuções; as ociosas são fechadas após o IdleConnTimeout do transporte padrão.
+// O limite de 30s vale para a fonte começar a responder.
+var sourceTransport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone() // mantém proxy, keep-alive e timeouts de conexão
+	t.ResponseHeaderTimeout = 30 * time.Second
+	return t
+}()
+
+// fetchTimeout limita a busca inteira no Data Source, incluindo novas tentativas e a leitura do corpo,
+// para que uma fonte que para de enviar dados faça a execução falhar em vez de segurar o lock
+// (PIPELINE_FETCH_TIMEOUT, padrão 10m)
+var fetchTimeout = 10 * time.Minute
+
+// errFetchTimeout é a causa do cancelamento quando fetchTimeout se esgota; não é repetida pelo retryPolicy
+var errFetchTimeout = errors.New("tempo limite da busca no Data Source esgotado")
+
+// Name mantém a URL como chave do watermark, compatível com os watermarks já gravados
+func (c httpConnector) Name() string { return c.url }
+
+func (c httpConnector) Fetch(since time.Time, emit func([]Order) error, progress func(fetchProgress)) error {
+	ctx, cancel := context.WithTimeoutCause(context.Background(), fetchTimeout, errFetchTimeout)
+	defer cancel()
+
+	var err error
+	if c.pagination.Style != paginationNone {
+		err = fetchPaginated(ctx, c.url, since, c.pagination, emit, progress)
+	} else {
+		err = fetchOrders(ctx, c.url, since, emit, progress)
+	}
+	switch {
+	case err == nil || !errors.Is(context.Cause(ctx), errFetchTimeout):
+		return err
+	case errors.Is(err, errFetchTimeout): // esgotado durante uma requisição
+		return fmt.Errorf("%w (PIPELINE_FETCH_TIMEOUT=%s)", err, fetchTimeout)
+	default: // esgotado durante a leitura do corpo, que falha com o erro do contexto
+		return fmt.Errorf("%w (PIPELINE_FETCH_TIMEOUT=%s): %w", errFetchTimeout, fetchTimeout, err)
+	}
+}
+
+// fileConnector lê todos os pedidos de um arquivo local e filtra por since em memória
+type fileConnector struct {
+	kind  string
+	path  string
+	parse func(io.Reader) ([]Order, error)
+}
+
+func (c fileConnector) Name() string { return c.kind + ":" + c.path }
+
+func (c fileConnector) Fetch(since time.Time, emit func([]Order) error, progress func(fetchProgress)) error {
+	orders, err := readOrdersFile(c.path, c.parse)
+	if err != nil {
+		return err
+	}
+	orders = filterSince(orders, since)
+	if progress != nil {
+		progress(fetchProgress{Pages: 1, Orders: len(orders)})
+	}
+	return emitBatches(orders, emit)
+}
+
+// dirConnector lê, em ordem alfabética, os arquivos de um diretório; o formato vem da extensão
+type dirConnector struct {
+	path string
+}
+
+func (c dirConnector) Name() string { return sourceDir + ":" + c.path }
+
+func (c dirConnector) Fetch(since time.Time, emit func([]Order) error, progress func(fetchProgress)) error {
+	entries, err := os.ReadDir(c.path) // já retorna ordenado por nome
+	if err != nil {
+		return fmt.Errorf("erro ao listar diretório %s: %w", c.path, err)
+	}
+
+	total, files := 0, 0 // um arquivo por vez em memória
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		var parse func(io.Reader) ([]Order, error)
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".csv":
+			parse = csvDefaultFormat.parse
+		case ".ndjson", ".jsonl":
+			parse = parseOrdersNDJSON
+		default:
+			log.Printf("⏭️  Arquivo ignorado (extensão não suportada): %s", entry.Name())
+			continue
+		}
+
+		orders, err := readOrdersFile(filepath.Join(c.path, entry.Name()), parse)
+		if err != nil {
+			return err
+		}
+		orders = filterSince(orders, since)
+		total += len(orders)
+		files++
+		if progress != nil {
+			progress(fetchProgress{Pages: files, Orders: total})
+		}
+		if err := emitBatches(orders, emit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readOrdersFile abre o arquivo e o interpreta com a função informada
+func readOrdersFile(path string, parse func(io.Reader) ([]Order, error)) ([]Order, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir arquivo: %w", err)
+	}
+	defer f.Close()
+
+	orders, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+	return orders, nil
+}
+
+// filterSince mantém os pedidos com created_at >= since, como o Data Source faz com ?since=.
+// Pedidos com created_at inválido são mantidos para que a validação os rejeite com o motivo.
+func filterSince(orders []Order, since time.Time) []Order {
+	if since.IsZero() {
+		return orders
+	}
+
+	filtered := orders[:0]
+	for _, order := range orders {
+		createdAt, err := time.Parse(time.RFC3339, order.CreatedAt)
+		if err != nil || !createdAt.Before(since) {
+			filtered = append(filtered, order)
+		}
+	}
+	return filtered
+}
+
+// parseOrdersNDJSON lê um pedido JSON por linha, ignorando linhas em branco
+func parseOrdersNDJSON(r io.Reader) ([]Order, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // linhas de até 1 MB
+
+	var orders []Order
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var order Order
+		if err := json.Unmarshal([]byte(text), &order); err != nil {
+			return nil, fmt.Errorf("linha %d: erro ao decodificar JSON: %w", line, err)
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, scanner.Err()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilterSince(t *testing.T) {
+	since := time.Date(2026, 1, 20, 10, 0, 0, 0, time.UTC)
+	orders := []Order{
+		{OrderID: "antes", CreatedAt: "2026-01-20T09:59:59Z"},
+		{OrderID: "igual", CreatedAt: "2026-01-20T10:00:00Z"},
+		{OrderID: "depois", CreatedAt: "2026-01-20T11:00:00Z"},
+		{OrderID: "outro-fuso", CreatedAt: "2026-01-20T08:00:00-03:00"}, // 11:00 UTC
+		{OrderID: "fuso-antes", CreatedAt: "2026-01-20T06:00:00-03:00"}, // 09:00 UTC
+		{OrderID: "invalido", CreatedAt: "ontem"},
+		{OrderID: "sem-fuso", CreatedAt: "2026-01-20T09:00:00"},
+	}
+
+	t.Run("com since", func(t *testing.T) {
+		got := filterSince(append([]Order(nil), orders...), since)
+		want := []string{"igual", "depois", "outro-fuso", "invalido", "sem-fuso"} // inválidos seguem para a validação
+		if len(got) != len(want) {
+			t.Fatalf("filterSince manteve %d pedidos (%+v), esperado %v", len(got), got, want)
+		}
+		for i, id := range want {
+			if got[i].OrderID != id {
+				t.Errorf("pedido %d = %s, esperado %s", i, got[i].OrderID, id)
+			}
+		}
+	})
+
+	t.Run("sem since", func(t *testing.T) {
+		if got := filterSince(append([]Order(nil), orders...), time.Time{}); len(got) != len(orders) {
+			t.Errorf("filterSince sem since manteve %d pedidos, esperado %d", len(got), len(orders))
+		}
+	})
+}
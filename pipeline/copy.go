@@ -0,0 +1,266 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// batchSize é a quantidade de pedidos enviados por COPY em cada lote (PIPELINE_BATCH_SIZE)
+var batchSize = 1000
+
+// parsedOrder é um pedido com created_at já convertido, pronto para gravação
+type parsedOrder struct {
+	Order
+	CreatedAtTime time.Time
+}
+
+// add soma as contagens de um lote às contagens totais
+func (s *insertStats) add(other insertStats) {
+	s.Inserted += other.Inserted
+	s.Updated += other.Updated
+	s.Skipped += other.Skipped
+	s.Failed += other.Failed
+	s.Rejected = append(s.Rejected, other.Rejected...)
+	if other.MaxCreatedAt.After(s.MaxCreatedAt) {
+		s.MaxCreatedAt = other.MaxCreatedAt
+	}
+	for key := range other.Touched {
+		s.touch(key)
+	}
+}
+
+// touch registra grupos de daily_metrics afetados pelos pedidos gravados
+func (s *insertStats) touch(keys ...aggregationKey) {
+	if s.Touched == nil {
+		s.Touched = make(map[aggregationKey]bool)
+	}
+	for _, key := range keys {
+		s.Touched[key] = true
+	}
+}
+
+// reject contabiliza um pedido descartado e guarda o motivo para o dead letter
+func (s *insertStats) reject(order Order, reason string) {
+	s.Failed++
+	s.Rejected = append(s.Rejected, rejection{Order: order, Reason: reason})
+}
+
+// copyBatch grava um lote em uma transação própria (modo tolerante).
+// Em vez de uma ida ao banco por pedido, o lote inteiro usa poucas idas e voltas.
+func copyBatch(db *sql.DB, runID int64, batch []parsedOrder, upsert bool) (insertStats, error) {
+	var stats insertStats
+
+	tx, err := db.Begin() // COPY exige transação; a tabela temporária é descartada no commit
+	if err != nil {
+		return stats, fmt.Errorf("erro ao iniciar transação: %w", err)
+	}
+	defer tx.Rollback() // sem efeito após o commit
+
+	if err := createStaging(tx); err != nil {
+		return stats, err
+	}
+	if err := copyToStaging(tx, batch); err != nil {
+		return stats, err
+	}
+	inserted, updated, touched, err := mergeStaging(tx, runID, upsert)
+	if err != nil {
+		return stats, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return stats, fmt.Errorf("erro ao confirmar transação: %w", err)
+	}
+
+	stats.Inserted = inserted
+	stats.Updated = updated
+	stats.Skipped = len(batch) - inserted - updated // o restante já existia no banco sem alteração
+	stats.touch(touched...)
+	stats.MaxCreatedAt = maxCreatedAt(batch)
+	return stats, nil
+}
+
+// strictCopy grava todos os lotes de uma execução em uma única transação (modo estrito).
+// Os lotes vão para o staging conforme chegam; raw_data.orders só é alterada em commit.
+type strictCopy struct {
+	tx           *sql.Tx
+	count        int // pedidos enviados ao staging
+	maxCreatedAt time.Time
+}
+
+// beginStrictCopy abre a transação e cria o staging que receberá todos os lotes
+func beginStrictCopy(db *sql.DB) (*strictCopy, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao iniciar transação: %w", err)
+	}
+	if err := createStaging(tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &strictCopy{tx: tx}, nil
+}
+
+// copy envia um lote para o staging, sem confirmar nada
+func (c *strictCopy) copy(batch []parsedOrder) error {
+	for start := 0; start < len(batch); start += batchSize {
+		if err := copyToStaging(c.tx, batch[start:min(start+batchSize, len(batch))]); err != nil {
+			return err
+		}
+	}
+	c.count += len(batch)
+	if created := maxCreatedAt(batch); created.After(c.maxCreatedAt) {
+		c.maxCreatedAt = created
+	}
+	return nil
+}
+
+// commit move o staging para raw_data.orders e confirma a transação.
+// Qualquer erro desfaz a transação inteira e nenhum pedido é gravado.
+func (c *strictCopy) commit(runID int64, upsert bool) (insertStats, error) {
+	var stats insertStats
+	defer c.tx.Rollback() // sem efeito após o commit
+
+	inserted, updated, touched, err := mergeStaging(c.tx, runID, upsert)
+	if err != nil {
+		return stats, err
+	}
+
+	if err := c.tx.Commit(); err != nil {
+		return stats, fmt.Errorf("erro ao confirmar transação: %w", err)
+	}
+
+	stats.Inserted = inserted
+	stats.Updated = updated
+	stats.Skipped = c.count - inserted - updated
+	stats.touch(touched...)
+	stats.MaxCreatedAt = c.maxCreatedAt
+	return stats, nil
+}
+
+// rollback descarta a transação e tudo o que foi enviado ao staging
+func (c *strictCopy) rollback() {
+	if err := c.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		log.Printf("⚠️  Erro ao desfazer transação do modo estrito: %v", err)
+	}
+}
+
+// createStaging cria a tabela temporária que recebe o COPY, descartada no fim da transação
+func createStaging(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TEMP TABLE orders_staging (
+			seq BIGSERIAL, -- ordem de chegada, para que a última ocorrência de um order_id prevaleça
+			order_id VARCHAR(255),
+			created_at TIMESTAMP,
+			status VARCHAR(50),
+			value NUMERIC(10, 2),
+			payment_method VARCHAR(50)
+		) ON COMMIT DROP
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela de staging: %w", err)
+	}
+	return nil
+}
+
+// copyToStaging envia os pedidos para a tabela temporária usando o protocolo COPY
+func copyToStaging(tx *sql.Tx, orders []parsedOrder) error {
+	stmt, err := tx.Prepare(pq.CopyIn("orders_staging", "order_id", "created_at", "status", "value", "payment_method"))
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar COPY: %w", err)
+	}
+
+	for _, order := range orders {
+		if _, err := stmt.Exec(order.OrderID, order.CreatedAtTime, order.Status, order.Value, order.PaymentMethod); err != nil {
+			stmt.Close()
+			return fmt.Errorf("erro ao copiar pedido %s: %w", order.OrderID, err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil { // Exec sem argumentos envia os dados pendentes do COPY
+		stmt.Close()
+		return fmt.Errorf("erro ao finalizar COPY: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("erro ao fechar COPY: %w", err)
+	}
+	return nil
+}
+
+// onConflictClause retorna o tratamento de pedidos já existentes em raw_data.orders (alias o).
+// No modo upsert, só atualiza quando status, value ou payment_method realmente mudaram.
+func onConflictClause(upsert bool) string {
+	if !upsert {
+		return "ON CONFLICT (order_id) DO NOTHING"
+	}
+	return `
+		ON CONFLICT (order_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			value = EXCLUDED.value,
+			payment_method = EXCLUDED.payment_method
+		WHERE (o.status, o.value, o.payment_method)
+			IS DISTINCT FROM (EXCLUDED.status, EXCLUDED.value, EXCLUDED.payment_method)
+	`
+}
+
+// mergeStaging move os pedidos do staging para raw_data.orders e retorna quantos foram inseridos e atualizados.
+// DISTINCT ON evita que o mesmo order_id apareça duas vezes no INSERT, o que o ON CONFLICT DO UPDATE não aceita.
+// Mudanças de status aplicadas são registradas em raw_data.order_status_history no mesmo comando.
+func mergeStaging(tx *sql.Tx, runID int64, upsert bool) (int, int, []aggregationKey, error) {
+	var inserted, updated int
+	var touched []byte
+	err := tx.QueryRow(`
+		WITH previous AS ( -- valores armazenados antes da gravação (todas as CTEs enxergam o mesmo snapshot)
+			SELECT order_id, status, payment_method
+			FROM raw_data.orders
+			WHERE order_id IN (SELECT order_id FROM orders_staging)
+		), merged AS (
+			INSERT INTO raw_data.orders AS o (order_id, created_at, status, value, payment_method)
+			SELECT DISTINCT ON (order_id) order_id, created_at, status, value, payment_method
+			FROM orders_staging
+			ORDER BY order_id, seq DESC
+			`+onConflictClause(upsert)+`
+			RETURNING o.order_id, o.created_at, o.status, o.payment_method, (xmax = 0) AS inserted -- xmax = 0 apenas para linhas recém-inseridas
+		), history AS (
+			INSERT INTO raw_data.order_status_history (order_id, old_status, new_status, run_id)
+			SELECT m.order_id, p.status, m.status, $1::BIGINT
+			FROM merged m
+			JOIN previous p ON p.order_id = m.order_id
+			WHERE NOT m.inserted AND p.status IS DISTINCT FROM m.status
+		), touched AS ( -- grupos de daily_metrics afetados: o novo de cada pedido gravado e o antigo dos atualizados
+			SELECT DATE(m.created_at) AS date, m.status, m.payment_method FROM merged m
+			UNION
+			SELECT DATE(m.created_at), p.status, p.payment_method -- created_at não muda no upsert
+			FROM merged m
+			JOIN previous p ON p.order_id = m.order_id
+		)
+		SELECT
+			(SELECT COUNT(*) FILTER (WHERE inserted) FROM merged),
+			(SELECT COUNT(*) FILTER (WHERE NOT inserted) FROM merged),
+			(SELECT COALESCE(json_agg(touched), '[]') FROM touched)
+	`, nullRunID(runID)).Scan(&inserted, &updated, &touched)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("erro ao inserir a partir do staging: %w", err)
+	}
+
+	var keys []aggregationKey
+	if err := json.Unmarshal(touched, &keys); err != nil {
+		return 0, 0, nil, fmt.Errorf("erro ao ler grupos afetados: %w", err)
+	}
+	return inserted, updated, keys, nil
+}
+
+// maxCreatedAt retorna o maior created_at de um conjunto de pedidos
+func maxCreatedAt(orders []parsedOrder) time.Time {
+	var max time.Time
+	for _, order := range orders {
+		if order.CreatedAtTime.After(max) {
+			max = order.CreatedAtTime
+		}
+	}
+	return max
+}
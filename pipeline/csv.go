@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// csvColumns são os campos de Order que precisam existir no arquivo
+var csvColumns = []string{"order_id", "created_at", "status", "value", "payment_method"}
+
+// maxUploadSize limita o corpo aceito em POST /ingest/csv
+const maxUploadSize = 32 << 20 // 32 MB
+
+// csvFormat descreve como ler um arquivo CSV de pedidos
+type csvFormat struct {
+	Delimiter rune              // separador de campos
+	Decimal   byte              // separador decimal de value: ',' ou '.'
+	Columns   map[string]string // campo de Order -> nome da coluna no cabeçalho; campos ausentes usam o próprio nome
+}
+
+// csvDefaultFormat é o formato de orders.csv: ponto e vírgula e vírgula decimal ("199,90").
+// Pode ser alterado por PIPELINE_CSV_DELIMITER, PIPELINE_CSV_DECIMAL e PIPELINE_CSV_COLUMNS.
+var csvDefaultFormat = csvFormat{Delimiter: ';', Decimal: ','}
+
+// withOverrides retorna uma cópia do formato com os valores informados (vazios mantêm os atuais).
+// columns segue o formato "campo=coluna,campo=coluna", ex.: "order_id=pedido,value=valor_total".
+func (f csvFormat) withOverrides(delimiter, decimal, columns string) (csvFormat, error) {
+	if delimiter != "" {
+		if delimiter == `\t` {
+			delimiter = "\t" // permite informar tabulação em variáveis de ambiente e query strings
+		}
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return f, fmt.Errorf("delimitador CSV inválido: %q", delimiter)
+		}
+		f.Delimiter = r
+	}
+
+	if decimal != "" {
+		if decimal != "," && decimal != "." {
+			return f, fmt.Errorf("separador decimal deve ser ',' ou '.', recebido %q", decimal)
+		}
+		f.Decimal = decimal[0]
+	}
+
+	if columns != "" {
+		mapped := make(map[string]string, len(f.Columns))
+		for field, column := range f.Columns {
+			mapped[field] = column
+		}
+		for _, pair := range strings.Split(columns, ",") {
+			field, column, ok := strings.Cut(pair, "=")
+			field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+			if !ok || field == "" || column == "" {
+				return f, fmt.Errorf("mapeamento de coluna inválido: %q (use campo=coluna)", pair)
+			}
+			if !isCSVField(field) {
+				return f, fmt.Errorf("campo desconhecido no mapeamento de colunas: %q", field)
+			}
+			mapped[field] = column
+		}
+		f.Columns = mapped
+	}
+
+	return f, nil
+}
+
+// isCSVField indica se o nome é um dos campos de Order
+func isCSVField(name string) bool {
+	for _, field := range csvColumns {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCSVFormat aplica PIPELINE_CSV_DELIMITER, PIPELINE_CSV_DECIMAL e PIPELINE_CSV_COLUMNS sobre o formato padrão
+func loadCSVFormat() (csvFormat, error) {
+	return csvDefaultFormat.withOverrides(
+		os.Getenv("PIPELINE_CSV_DELIMITER"),
+		os.Getenv("PIPELINE_CSV_DECIMAL"),
+		os.Getenv("PIPELINE_CSV_COLUMNS"),
+	)
+}
+
+// parseValue converte value respeitando o separador decimal. O outro separador só é aceito como milhar,
+// na parte inteira e em grupos de exatamente três dígitos ("1.299,90"); "199.90" com decimal ',' é recusado
+// em vez de virar 19990.
+func (f csvFormat) parseValue(raw string) (float64, error) {
+	thousands := "."
+	if f.Decimal == '.' {
+		thousands = ","
+	}
+
+	integer, fraction, hasFraction := strings.Cut(strings.TrimSpace(raw), string(f.Decimal))
+	sign := ""
+	if strings.HasPrefix(integer, "-") || strings.HasPrefix(integer, "+") {
+		sign, integer = integer[:1], integer[1:]
+	}
+	if strings.Contains(integer, thousands) {
+		groups := strings.Split(integer, thousands)
+		for i, group := range groups {
+			if (i == 0 && (group == "" || len(group) > 3)) || (i > 0 && len(group) != 3) {
+				return 0, fmt.Errorf("separador de milhar %q fora de posição em %q", thousands, raw)
+			}
+		}
+		integer = strings.Join(groups, "")
+	}
+
+	normalized := sign + integer
+	if hasFraction {
+		normalized += "." + fraction // o separador de milhar na parte decimal faz o ParseFloat falhar
+	}
+	return strconv.ParseFloat(normalized, 64)
+}
+
+// parse lê os pedidos de um CSV com cabeçalho.
+// As colunas são localizadas pelo cabeçalho, então a ordem delas no arquivo não importa.
+func (f csvFormat) parse(r io.Reader) ([]Order, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = f.Delimiter
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil // arquivo vazio
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler cabeçalho CSV: %w", err)
+	}
+
+	position := make(map[string]int, len(header))
+	for i, name := range header {
+		position[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i // ignora o BOM de arquivos exportados por planilhas
+	}
+
+	index := make(map[string]int, len(csvColumns)) // campo de Order -> posição no registro
+	for _, field := range csvColumns {
+		column := field
+		if mapped, ok := f.Columns[field]; ok {
+			column = mapped
+		}
+		i, ok := position[column]
+		if !ok {
+			return nil, fmt.Errorf("coluna %q (campo %s) ausente no cabeçalho CSV", column, field)
+		}
+		index[field] = i
+	}
+
+	var orders []Order
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler linha CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		value, err := f.parseValue(record[index["value"]]) // "199,90" -> 199.90
+		if err != nil {
+			return nil, fmt.Errorf("linha %d: value inválido %q", line, record[index["value"]])
+		}
+
+		orders = append(orders, Order{
+			OrderID:       record[index["order_id"]],
+			CreatedAt:     record[index["created_at"]],
+			Status:        record[index["status"]],
+			Value:         value,
+			PaymentMethod: record[index["payment_method"]],
+		})
+	}
+
+	return orders, nil
+}
+
+// ingestCSVHandler recebe um arquivo CSV e o grava pelo mesmo caminho das demais execuções
+// (POST /ingest/csv?delimiter=;&decimal=,&columns=campo=coluna&async=true&strict=true&upsert=true).
+// O arquivo pode vir como corpo da requisição ou no campo "file" de um formulário multipart.
+func ingestCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Println("\n=== Ingestão de CSV disparada via HTTP ===")
+
+	query := r.URL.Query()
+	format, err := csvDefaultFormat.withOverrides(query.Get("delimiter"), query.Get("decimal"), query.Get("columns"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := defaultRunOptions(triggerUpload)
+	opts.Mode = modeFull // o arquivo enviado não usa nem avança o watermark da fonte
+	if opts.Strict, err = boolParam(r, "strict", opts.Strict); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Upsert, err = boolParam(r, "upsert", opts.Upsert); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			if rejectTooLarge(w, err) {
+				return
+			}
+			http.Error(w, fmt.Sprintf("campo file ausente ou inválido: %v", err), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	orders, err := format.parse(body)
+	if err != nil {
+		if rejectTooLarge(w, err) {
+			return
+		}
+		http.Error(w, fmt.Sprintf("CSV inválido: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(orders) == 0 {
+		http.Error(w, "CSV sem pedidos", http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("📄 %d pedidos lidos do CSV enviado\n", len(orders))
+
+	opts.Upload = orders
+	dispatchJob(w, opts, query.Get("async") == "true")
+}
+
+// rejectTooLarge responde 413 se err vier do limite de maxUploadSize, tanto no corpo cru
+// quanto no multipart (que o FormFile lê por inteiro antes de devolver o campo)
+func rejectTooLarge(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	http.Error(w, fmt.Sprintf("arquivo maior que %d bytes", maxUploadSize), http.StatusRequestEntityTooLarge)
+	return true
+}
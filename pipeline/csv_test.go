@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCSVParseValue(t *testing.T) {
+	comma := csvFormat{Delimiter: ';', Decimal: ','}
+	dot := csvFormat{Delimiter: ',', Decimal: '.'}
+
+	tests := []struct {
+		name    string
+		format  csvFormat
+		raw     string
+		want    float64
+		wantErr bool
+	}{
+		{"vírgula decimal", comma, "199,90", 199.90, false},
+		{"milhar com ponto", comma, "1.299,90", 1299.90, false},
+		{"vários grupos de milhar", comma, "1.234.567,5", 1234567.5, false},
+		{"inteiro", comma, "199", 199, false},
+		{"milhar sem decimais", comma, "1.299", 1299, false},
+		{"negativo", comma, "-1.299,90", -1299.90, false},
+		{"espaços", comma, " 199,90 ", 199.90, false},
+		{"ponto como decimal", comma, "199.90", 0, true}, // não pode virar 19990
+		{"ponto com uma casa", comma, "199.9", 0, true},
+		{"grupo de milhar curto", comma, "1.29,90", 0, true},
+		{"grupo inicial longo", comma, "1299.900,00", 0, true},
+		{"milhar na parte decimal", comma, "199,9.0", 0, true},
+		{"duas vírgulas", comma, "1,2,3", 0, true},
+		{"vazio", comma, "", 0, true},
+
+		{"ponto decimal", dot, "199.90", 199.90, false},
+		{"milhar com vírgula", dot, "1,299.90", 1299.90, false},
+		{"vírgula como decimal", dot, "199,90", 0, true}, // não pode virar 19990
+		{"vírgula com uma casa", dot, "199,9", 0, true},
+		{"milhar na parte decimal (ponto)", dot, "199.9,0", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.format.parseValue(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseValue(%q) erro = %v, esperado erro: %v", tt.name, tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("%s: parseValue(%q) = %v, esperado %v", tt.name, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestCSVParse(t *testing.T) {
+	t.Run("BOM no cabeçalho", func(t *testing.T) {
+		data := "\ufefforder_id;created_at;status;value;payment_method\n" +
+			"ORD-1;2026-01-20T10:00:00Z;approved;1.299,90;pix\n" +
+			"ORD-2;2026-01-20T11:00:00Z;pending;199,90;boleto\n"
+
+		orders, err := csvDefaultFormat.parse(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		want := []Order{
+			{OrderID: "ORD-1", CreatedAt: "2026-01-20T10:00:00Z", Status: "approved", Value: 1299.90, PaymentMethod: "pix"},
+			{OrderID: "ORD-2", CreatedAt: "2026-01-20T11:00:00Z", Status: "pending", Value: 199.90, PaymentMethod: "boleto"},
+		}
+		if len(orders) != len(want) {
+			t.Fatalf("parse devolveu %d pedidos, esperado %d", len(orders), len(want))
+		}
+		for i := range want {
+			if orders[i] != want[i] {
+				t.Errorf("pedido %d = %+v, esperado %+v", i, orders[i], want[i])
+			}
+		}
+	})
+
+	t.Run("colunas remapeadas em outra ordem", func(t *testing.T) {
+		format, err := csvDefaultFormat.withOverrides(",", ".", "order_id=pedido,value=valor_total")
+		if err != nil {
+			t.Fatalf("withOverrides: %v", err)
+		}
+		data := "payment_method,valor_total,status,created_at,pedido\n" +
+			"credit_card,\"1,299.90\",approved,2026-01-20T10:00:00Z,ORD-1\n"
+
+		orders, err := format.parse(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		want := Order{OrderID: "ORD-1", CreatedAt: "2026-01-20T10:00:00Z", Status: "approved", Value: 1299.90, PaymentMethod: "credit_card"}
+		if len(orders) != 1 || orders[0] != want {
+			t.Errorf("parse = %+v, esperado [%+v]", orders, want)
+		}
+	})
+
+	t.Run("coluna mapeada ausente", func(t *testing.T) {
+		format, err := csvDefaultFormat.withOverrides("", "", "value=valor")
+		if err != nil {
+			t.Fatalf("withOverrides: %v", err)
+		}
+		data := "order_id;created_at;status;value;payment_method\nORD-1;2026-01-20T10:00:00Z;approved;199,90;pix\n"
+		if _, err := format.parse(strings.NewReader(data)); err == nil {
+			t.Error("parse aceitou um cabeçalho sem a coluna mapeada")
+		}
+	})
+
+	t.Run("separador decimal trocado é erro de linha", func(t *testing.T) {
+		data := "order_id;created_at;status;value;payment_method\n" +
+			"ORD-1;2026-01-20T10:00:00Z;approved;199,90;pix\n" +
+			"ORD-2;2026-01-20T11:00:00Z;approved;199.90;pix\n"
+
+		_, err := csvDefaultFormat.parse(strings.NewReader(data))
+		if err == nil || !strings.Contains(err.Error(), "linha 3") {
+			t.Errorf("parse erro = %v, esperado erro na linha 3", err)
+		}
+	})
+}
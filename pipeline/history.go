@@ -0,0 +1,35 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// setupStatusHistoryTable cria a tabela que registra cada mudança de status observada em um pedido
+func setupStatusHistoryTable(db *sql.DB) error {
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS raw_data.order_status_history (
+			id BIGSERIAL PRIMARY KEY,
+			order_id VARCHAR(255) NOT NULL,
+			old_status VARCHAR(50) NOT NULL,
+			new_status VARCHAR(50) NOT NULL,
+			observed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			run_id BIGINT
+		)
+	`
+
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("erro ao criar tabela raw_data.order_status_history: %w", err)
+	}
+
+	// Consultas típicas buscam a linha do tempo de um pedido
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS order_status_history_order_id_idx ON raw_data.order_status_history (order_id, observed_at)"); err != nil {
+		return fmt.Errorf("erro ao criar índice de raw_data.order_status_history: %w", err)
+	}
+	return nil
+}
+
+// nullRunID converte o id da execução para NULL quando não há registro em pipeline.runs
+func nullRunID(runID int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: runID, Valid: runID != 0}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ingestion recebe os pedidos da fonte em lotes e os valida e grava conforme chegam,
+// para que a memória usada não dependa do tamanho da fonte
+type ingestion struct {
+	db    *sql.DB
+	runID int64
+	opts  RunOptions
+	now   time.Time // referência da regra de created_at no futuro, fixa durante a execução
+
+	fetched int
+	stats   insertStats    // contagens acumuladas; Rejected é esvaziado a cada lote gravado no dead letter
+	counts  map[string]int // pedidos reprovados na validação, por regra
+	strict  *strictCopy    // transação aberta durante toda a execução no modo estrito
+	err     error          // primeiro erro de gravação, para diferenciá-lo de erros da fonte
+}
+
+func newIngestion(db *sql.DB, runID int64, opts RunOptions) *ingestion {
+	return &ingestion{
+		db:     db,
+		runID:  runID,
+		opts:   opts,
+		now:    time.Now(),
+		counts: make(map[string]int),
+	}
+}
+
+// add valida e grava um lote. No modo tolerante cada lote é confirmado ao ser gravado;
+// no modo estrito os lotes vão para o staging e só são confirmados em finish.
+func (in *ingestion) add(orders []Order) error {
+	in.fetched += len(orders)
+
+	valid, stats, counts := validateOrders(orders, orderMapping, orderRules, in.now)
+	for rule, n := range counts {
+		in.counts[rule] += n
+	}
+
+	var err error
+	switch {
+	case in.opts.Strict && (in.stats.Failed > 0 || stats.Failed > 0):
+		// A execução já vai falhar; os lotes seguintes são apenas validados para que todos os inválidos sejam relatados
+		in.stats.add(stats)
+		if in.strict != nil {
+			in.strict.rollback()
+			in.strict = nil
+		}
+	case in.opts.Strict:
+		in.stats.add(stats)
+		if in.strict == nil {
+			if in.strict, err = beginStrictCopy(in.db); err != nil {
+				break
+			}
+		}
+		err = in.strict.copy(valid)
+	default:
+		var inserted insertStats
+		inserted, err = insertOrders(in.db, in.runID, valid, in.opts) // insertOrders é uma função que insere os pedidos no banco de dados
+		stats.add(inserted)
+		in.stats.add(stats)
+	}
+
+	// Guardar os pedidos rejeitados do lote para consulta e reprocessamento, mesmo se a gravação falhar
+	if saveErr := in.flushRejections(); saveErr != nil {
+		if err == nil {
+			err = saveErr
+		} else {
+			log.Printf("⚠️  %v", saveErr)
+		}
+	}
+
+	if err != nil {
+		in.err = err
+		return err
+	}
+	return nil
+}
+
+// flushRejections grava no dead letter os rejeitados acumulados desde o último lote
+func (in *ingestion) flushRejections() error {
+	if len(in.stats.Rejected) == 0 {
+		return nil
+	}
+	err := saveRejections(in.db, in.runID, in.stats.Rejected)
+	in.stats.Rejected = nil
+	return err
+}
+
+// finish encerra a ingestão. fetchErr é o erro devolvido pela fonte (ou nil se ela foi lida até o fim).
+// No modo estrito, confirma a transação apenas se a fonte foi lida até o fim sem nenhum pedido inválido.
+func (in *ingestion) finish(fetchErr error) error {
+	if in.strict != nil {
+		if fetchErr == nil && in.stats.Failed == 0 {
+			stats, err := in.strict.commit(in.runID, in.opts.Upsert)
+			if err != nil {
+				in.err = err
+			}
+			in.stats.add(stats)
+		} else {
+			in.strict.rollback()
+		}
+		in.strict = nil
+	}
+
+	switch {
+	case in.err != nil:
+		return fmt.Errorf("erro ao inserir pedidos: %w", in.err)
+	case fetchErr != nil:
+		return fmt.Errorf("erro ao buscar pedidos: %w", fetchErr)
+	case in.opts.Strict && in.stats.Failed > 0:
+		return fmt.Errorf("erro ao inserir pedidos: modo estrito: %d pedidos inválidos, nenhum pedido foi gravado", in.stats.Failed)
+	}
+	return nil
+}
+
+// emitBatches entrega pedidos já carregados em memória em lotes de batchSize
+func emitBatches(orders []Order, emit func([]Order) error) error {
+	for start := 0; start < len(orders); start += batchSize {
+		if err := emit(orders[start:min(start+batchSize, len(orders))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
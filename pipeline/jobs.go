@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status possíveis de um job do pipeline
+const (
+	jobStatusQueued    = "queued"
+	jobStatusRunning   = "running"
+	jobStatusSucceeded = "succeeded"
+	jobStatusFailed    = "failed"
+)
+
+// maxFinishedJobs limita quantos jobs finalizados ficam em memória
+const maxFinishedJobs = 200
+
+// Job representa uma execução do pipeline disparada via /trigger
+type Job struct {
+	ID                string         `json:"id"`
+	Status            string         `json:"status"`
+	Trigger           string         `json:"trigger"`          // manual, schedule, replay ou upload
+	Mode              string         `json:"mode"`             // incremental ou full
+	Strict            bool           `json:"strict"`           // tudo ou nada
+	Upsert            bool           `json:"upsert"`           // atualiza pedidos existentes
+	RunID             int64          `json:"run_id,omitempty"` // id da execução em pipeline.runs, disponível após o início
+	Inserted          int            `json:"inserted"`
+	Updated           int            `json:"updated"`
+	Skipped           int            `json:"skipped"`
+	Failed            int            `json:"failed"`
+	Total             int            `json:"total"`
+	Rejections        map[string]int `json:"rejections,omitempty"` // pedidos reprovados na validação, por regra
+	TransformerStatus string         `json:"transformer_status,omitempty"`
+	Error             string         `json:"error,omitempty"`
+	CreatedAt         string         `json:"created_at"`
+	StartedAt         string         `json:"started_at,omitempty"`
+	FinishedAt        string         `json:"finished_at,omitempty"`
+
+	opts RunOptions    // opções com que o pipeline será executado
+	done chan struct{} // fechado quando o job termina, permite que outras requisições aguardem o resultado
+	lock *pipelineLock // advisory lock mantido durante a execução
+	err  error         // erro da execução; errPipelineBusy quando o lock estava com outra sessão
+}
+
+// jobStore guarda os jobs em memória, protegidos por mutex pois são acessados por várias goroutines
+type jobStore struct {
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	finished []string // ids dos jobs finalizados, do mais antigo para o mais recente
+	active   *Job     // job em execução neste processo; no máximo um por vez
+}
+
+var jobs = &jobStore{jobs: make(map[string]*Job)}
+
+// newJobID gera um identificador aleatório em hexadecimal
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano()) // fallback improvável: usa o horário atual
+	}
+	return hex.EncodeToString(b)
+}
+
+// start reserva a execução do pipeline para um novo job com status queued.
+// Se já houver um job ativo neste processo, retorna esse job junto com errPipelineBusy.
+// Se o advisory lock estiver com outra réplica, retorna job nil e errPipelineBusy.
+func (s *jobStore) start(opts RunOptions) (*Job, error) {
+	s.mu.Lock()
+	if s.active != nil {
+		active := s.active
+		s.mu.Unlock()
+		return active, errPipelineBusy
+	}
+
+	job := &Job{
+		ID:        newJobID(),
+		Status:    jobStatusQueued,
+		Trigger:   opts.Trigger,
+		Mode:      opts.Mode,
+		Strict:    opts.Strict,
+		Upsert:    opts.Upsert,
+		opts:      opts,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		done:      make(chan struct{}),
+	}
+	s.jobs[job.ID] = job
+	s.active = job
+	s.mu.Unlock()
+
+	// Garantir exclusividade também entre réplicas
+	lock, err := acquirePipelineLock()
+	if err != nil {
+		s.finish(job, 0, RunResult{}, err) // o job fica registrado como falho
+		return nil, err
+	}
+	job.lock = lock
+
+	// Com o lock em mãos, qualquer execução ainda em running foi interrompida antes de terminar
+	if n, err := failInterruptedRuns(db); err != nil {
+		log.Printf("⚠️  %v", err)
+	} else if n > 0 {
+		log.Printf("⚠️  %d execuções interrompidas marcadas como falhas", n)
+	}
+	return job, nil
+}
+
+// joinable indica se uma requisição com opts pode aguardar o job em andamento e receber o resultado dele.
+// Só vale quando o job faz exatamente o que foi pedido: outra origem (ex.: reprocessamento sobre ingestão),
+// outra modalidade (ex.: full sobre incremental), um rejeitado específico ou um arquivo enviado
+// não podem ser atendidos por essa execução.
+func (s *jobStore) joinable(job *Job, opts RunOptions) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := job.opts
+	return opts.Upload == nil && active.Upload == nil &&
+		opts.ReplayID == 0 && active.ReplayID == 0 &&
+		opts.Trigger == active.Trigger &&
+		opts.Mode == active.Mode &&
+		opts.Strict == active.Strict &&
+		opts.Upsert == active.Upsert
+}
+
+// get retorna uma cópia do job para leitura segura fora do mutex
+func (s *jobStore) get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// snapshot retorna uma cópia do job lida com o mutex adquirido
+func (s *jobStore) snapshot(job *Job) Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *job
+}
+
+// update aplica uma alteração no job com o mutex adquirido
+func (s *jobStore) update(job *Job, fn func(*Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(job)
+}
+
+// finish marca o job como finalizado, descarta os jobs finalizados mais antigos e retorna uma cópia do job
+func (s *jobStore) finish(job *Job, runID int64, result RunResult, runErr error) Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job.Status = jobStatusSucceeded
+	if runErr != nil {
+		job.Status = jobStatusFailed
+		job.Error = runErr.Error()
+	}
+	job.err = runErr
+	job.RunID = runID
+	job.Inserted = result.Inserted
+	job.Updated = result.Updated
+	job.Skipped = result.Skipped
+	job.Failed = result.Failed
+	job.Total = result.Fetched
+	job.Rejections = result.Rejections
+	job.TransformerStatus = result.TransformerStatus
+	job.FinishedAt = time.Now().Format(time.RFC3339)
+	job.opts.Upload = nil // libera os pedidos do arquivo enviado; o job fica em memória até ser descartado
+	close(job.done)
+
+	if s.active == job {
+		s.active = nil // libera a vaga para o próximo disparo
+	}
+
+	s.finished = append(s.finished, job.ID)
+	for len(s.finished) > maxFinishedJobs {
+		delete(s.jobs, s.finished[0])
+		s.finished = s.finished[1:]
+	}
+	return *job
+}
+
+// run executa o pipeline para o job, atualiza seu status ao longo da execução e retorna o job finalizado
+func (s *jobStore) run(job *Job) Job {
+	s.update(job, func(j *Job) {
+		j.Status = jobStatusRunning
+		j.StartedAt = time.Now().Format(time.RFC3339)
+	})
+
+	runID, result, err := executeRun(job.opts, func(runID int64) {
+		s.update(job, func(j *Job) { j.RunID = runID })
+	})
+	if err != nil {
+		log.Printf("❌ Job %s falhou: %v", job.ID, err)
+	}
+
+	job.lock.release()
+
+	return s.finish(job, runID, result, err)
+}
+
+// jobHandler retorna o status de um job (GET /jobs/{id})
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/") // extrai o {id} do caminho
+	job, ok := jobs.get(id)
+	if !ok {
+		http.Error(w, "Job não encontrado", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
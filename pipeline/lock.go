@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// pipelineLockKey identifica o advisory lock do pipeline no PostgreSQL; qualquer réplica usa a mesma chave
+const pipelineLockKey int64 = 7_310_001
+
+// errPipelineBusy indica que já existe uma execução do pipeline em andamento (neste processo ou em outra réplica)
+var errPipelineBusy = errors.New("pipeline já está em execução")
+
+// pipelineLock mantém a conexão dedicada que segura o advisory lock.
+// Advisory locks pertencem à sessão, por isso a mesma conexão precisa ser usada para liberar.
+type pipelineLock struct {
+	conn *sql.Conn
+}
+
+// acquirePipelineLock tenta obter o advisory lock sem bloquear; retorna errPipelineBusy se outra sessão já o detém
+func acquirePipelineLock() (*pipelineLock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := db.Conn(ctx) // reserva uma conexão do pool só para o lock
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter conexão para o lock: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", pipelineLockKey).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("erro ao obter advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, errPipelineBusy
+	}
+
+	return &pipelineLock{conn: conn}, nil
+}
+
+// release libera o advisory lock e devolve a conexão ao pool
+func (l *pipelineLock) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", pipelineLockKey); err != nil {
+		log.Printf("⚠️  Erro ao liberar advisory lock: %v", err)
+		// Descartar a conexão encerra a sessão no PostgreSQL, o que também libera o lock
+		l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	l.conn.Close()
+}
+
+// runningRunID busca a execução em andamento registrada em pipeline.runs (possivelmente de outra réplica)
+func runningRunID(db *sql.DB) int64 {
+	var id int64
+	err := db.QueryRow("SELECT id FROM pipeline.runs WHERE status = $1 ORDER BY id DESC LIMIT 1", runStatusRunning).Scan(&id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("⚠️  Erro ao buscar execução em andamento: %v", err)
+	}
+	return id
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,14 +30,35 @@ type Order struct {
 
 // PipelineResponse representa a resposta do endpoint /trigger
 type PipelineResponse struct {
-	Success   bool   `json:"success"`
-	Message   string `json:"message"`
-	Inserted  int    `json:"inserted"`
-	Total     int    `json:"total"`
-	Timestamp string `json:"timestamp"`
+	Success           bool           `json:"success"`
+	Message           string         `json:"message"`
+	RunID             int64          `json:"run_id,omitempty"` // id da execução em pipeline.runs
+	JobID             string         `json:"job_id,omitempty"` // id do job, consultável em GET /jobs/{id}
+	Inserted          int            `json:"inserted"`
+	Updated           int            `json:"updated"` // pedidos existentes alterados no modo upsert
+	Skipped           int            `json:"skipped"`
+	Failed            int            `json:"failed"`
+	Total             int            `json:"total"`
+	Rejections        map[string]int `json:"rejections,omitempty"` // pedidos reprovados na validação, por regra
+	TransformerStatus string         `json:"transformer_status,omitempty"`
+	Timestamp         string         `json:"timestamp"`
+}
+
+// HealthResponse representa a resposta do endpoint /health
+type HealthResponse struct {
+	Status      string           `json:"status"`
+	Scheduler   *SchedulerStatus `json:"scheduler,omitempty"` // presente apenas quando PIPELINE_SCHEDULE está configurada
+	Transformer BreakerStatus    `json:"transformer_breaker"` // estado do circuit breaker do transformer
 }
 
 var db *sql.DB
+var strictDefault bool // PIPELINE_STRICT: tudo ou nada por padrão
+var upsertDefault bool // PIPELINE_UPSERT: atualiza pedidos existentes por padrão
+
+// upsertLookback é a janela revisitada antes do watermark nas cargas incrementais com upsert
+// (PIPELINE_UPSERT_LOOKBACK). O watermark segue created_at, então sem ela uma mudança de status
+// em pedido antigo nunca seria buscada; zero (padrão) faz o upsert buscar todos os pedidos.
+var upsertLookback time.Duration
 var dataSourceURL string  // var global
 var transformerURL string // var global
 
@@ -63,12 +90,139 @@ func main() {
 		}
 	}
 
-	fmt.Printf("Data Source URL: %s\n", dataSourceURL)
+	// Formato dos arquivos CSV (fonte csv/dir e POST /ingest/csv); o padrão é o de orders.csv
+	var err error
+	csvDefaultFormat, err = loadCSVFormat()
+	if err != nil {
+		log.Fatalf("Formato CSV inválido: %v", err)
+	}
+
+	// Paginação da fonte HTTP, ex.: PIPELINE_PAGINATION=page PIPELINE_PAGE_SIZE=500
+	pagination, err = loadPaginationConfig()
+	if err != nil {
+		log.Fatalf("Paginação inválida: %v", err)
+	}
+	if pagination.Style != paginationNone {
+		fmt.Printf("Paginação: %s (%d pedidos por página)\n", pagination.Style, pagination.PageSize)
+	}
+
+	// Tempo máximo de uma busca no Data Source, ex.: PIPELINE_FETCH_TIMEOUT=30m
+	if v := os.Getenv("PIPELINE_FETCH_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("PIPELINE_FETCH_TIMEOUT inválida: %q", v)
+		}
+		fetchTimeout = d
+	}
+
+	// Novas tentativas nas chamadas ao Data Source e ao transformer, ex.: PIPELINE_SOURCE_RETRY_MAX_ATTEMPTS=5
+	if sourceRetry, err = loadRetryPolicy("PIPELINE_SOURCE_RETRY_"); err != nil {
+		log.Fatalf("Política de novas tentativas inválida: %v", err)
+	}
+	if transformerRetry, err = loadRetryPolicy("PIPELINE_TRANSFORMER_RETRY_"); err != nil {
+		log.Fatalf("Política de novas tentativas inválida: %v", err)
+	}
+
+	// Agregação feita pelo serviço transformer (padrão) ou pelo próprio pipeline (PIPELINE_AGGREGATION=native)
+	if v := os.Getenv("PIPELINE_AGGREGATION"); v != "" {
+		if v != aggregationTransformer && v != aggregationNative {
+			log.Fatalf("PIPELINE_AGGREGATION desconhecida: %q (use transformer ou native)", v)
+		}
+		aggregationMode = v
+	}
+	fullAggregation = boolEnv("PIPELINE_FULL_AGGREGATION") // por padrão, só os grupos tocados pela execução são recalculados
+	if fullAggregation {
+		fmt.Printf("Agregação: %s (reconstrução completa)\n", aggregationMode)
+	} else {
+		fmt.Printf("Agregação: %s (incremental)\n", aggregationMode)
+	}
+
+	// Circuit breaker do transformer, ex.: PIPELINE_TRANSFORMER_BREAKER_THRESHOLD=3 PIPELINE_TRANSFORMER_BREAKER_COOLDOWN=1m
+	if v := os.Getenv("PIPELINE_TRANSFORMER_BREAKER_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("PIPELINE_TRANSFORMER_BREAKER_THRESHOLD inválida: %q", v)
+		}
+		transformerBreaker.threshold = n
+	}
+	if v := os.Getenv("PIPELINE_TRANSFORMER_BREAKER_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("PIPELINE_TRANSFORMER_BREAKER_COOLDOWN inválida: %q", v)
+		}
+		transformerBreaker.cooldown = d
+	}
+	transformerBreaker.onHalfOpen = retryPendingAggregation
+
+	// Fonte dos pedidos: API do Data Source (padrão) ou arquivos locais, ex.: PIPELINE_SOURCE=csv PIPELINE_SOURCE_PATH=/data/orders.csv
+	sourceKind := os.Getenv("PIPELINE_SOURCE")
+	sourceLocation := dataSourceURL
+	if sourceKind != "" && sourceKind != sourceHTTP {
+		sourceLocation = os.Getenv("PIPELINE_SOURCE_PATH")
+	}
+	source, err = newConnector(sourceKind, sourceLocation)
+	if err != nil {
+		log.Fatalf("Fonte de dados inválida: %v", err)
+	}
+
+	fmt.Printf("Fonte de dados: %s\n", source.Name())
 	fmt.Printf("Transformer URL: %s\n", transformerURL)
 	fmt.Printf("Database URL: %s\n", databaseURL)
 
+	// Tamanho dos lotes enviados via COPY
+	if v := os.Getenv("PIPELINE_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("PIPELINE_BATCH_SIZE inválida: %q", v)
+		}
+		batchSize = n
+	}
+	fmt.Printf("Tamanho do lote: %d\n", batchSize)
+
+	// Modos padrão de gravação (podem ser sobrescritos por ?strict= e ?upsert= em /trigger)
+	strictDefault = boolEnv("PIPELINE_STRICT")
+	upsertDefault = boolEnv("PIPELINE_UPSERT")
+	fmt.Printf("Modo estrito: %t\n", strictDefault)
+	fmt.Printf("Modo upsert: %t\n", upsertDefault)
+	if v := os.Getenv("PIPELINE_UPSERT_LOOKBACK"); v != "" { // ex.: 720h revisita os últimos 30 dias
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("PIPELINE_UPSERT_LOOKBACK inválida: %q", v)
+		}
+		upsertLookback = d
+	}
+	if upsertLookback > 0 {
+		fmt.Printf("Janela do upsert incremental: %s antes do watermark\n", upsertLookback)
+	} else {
+		fmt.Println("Janela do upsert incremental: todos os pedidos (PIPELINE_UPSERT_LOOKBACK não configurada)")
+	}
+
+	// Regras de validação dos pedidos recebidos
+	orderRules, err = loadValidationRules()
+	if err != nil {
+		log.Fatalf("Regras de validação inválidas: %v", err)
+	}
+
+	// Mapeamento opcional de grafias de status e método de pagamento, ex.: PIPELINE_MAPPING_FILE=/app/mappings.json.
+	// PIPELINE_REJECT_UNMAPPED=true rejeita valores sem mapeamento; por padrão eles passam como vieram.
+	if path := os.Getenv("PIPELINE_MAPPING_FILE"); path != "" {
+		orderMapping, err = loadMapping(path, boolEnv("PIPELINE_REJECT_UNMAPPED"))
+		if err != nil {
+			log.Fatalf("PIPELINE_MAPPING_FILE inválida: %v", err)
+		}
+		fmt.Printf("Mapeamento de valores: %s (rejeitar não mapeados: %t)\n", path, orderMapping.RejectUnmapped)
+	}
+
+	// Agendamento opcional no formato cron, ex.: PIPELINE_SCHEDULE="*/15 * * * *"
+	if schedule := os.Getenv("PIPELINE_SCHEDULE"); schedule != "" {
+		pipelineScheduler, err = newScheduler(schedule)
+		if err != nil {
+			log.Fatalf("PIPELINE_SCHEDULE inválida: %v", err)
+		}
+		fmt.Printf("Agendamento: %s\n", schedule)
+	}
+
 	// Conectar ao PostgreSQL
-	var err error
 	db, err = sql.Open("postgres", databaseURL) // sql.Open é uma função que abre uma conexão com o PostgreSQL (sem API, conexão direta via driver de banco de dados)
 	if err != nil {
 		log.Fatalf("Erro ao conectar ao PostgreSQL: %v", err)
@@ -87,10 +241,23 @@ func main() {
 	}
 	fmt.Println("✅ Schema e tabela verificados/criados")
 
+	// Iniciar agendador, que compartilha histórico e trava com os disparos manuais
+	if pipelineScheduler != nil {
+		go pipelineScheduler.run()
+		fmt.Println("✅ Agendador iniciado")
+	}
+
 	// Configurar rotas HTTP
 	// handler é uma função que processa a requisição e escreve a resposta
-	http.HandleFunc("/health", healthHandler)   // registra handler para GET /health
-	http.HandleFunc("/trigger", triggerHandler) // registra handler para POST /trigger
+	http.HandleFunc("/health", healthHandler)          // registra handler para GET /health
+	http.HandleFunc("/trigger", triggerHandler)        // registra handler para POST /trigger
+	http.HandleFunc("/runs", runsHandler)              // registra handler para GET /runs
+	http.HandleFunc("/runs/", runHandler)              // registra handler para GET /runs/{id}
+	http.HandleFunc("/jobs/", jobHandler)              // registra handler para GET /jobs/{id}
+	http.HandleFunc("/rejected", rejectedHandler)      // registra handler para GET /rejected
+	http.HandleFunc("/rejected/replay", replayHandler) // registra handler para POST /rejected/replay
+	http.HandleFunc("/ingest/csv", ingestCSVHandler)   // registra handler para POST /ingest/csv
+	http.HandleFunc("/aggregate", aggregateHandler)    // registra handler para POST /aggregate
 
 	// Iniciar servidor HTTP
 	port := os.Getenv("PORT") // port é a porta do servidor HTTP
@@ -101,7 +268,14 @@ func main() {
 	fmt.Printf("\n🚀 Servidor HTTP iniciado na porta %s\n", port)
 	fmt.Println("Endpoints disponíveis:")
 	fmt.Println("  - GET  /health  - Health check")
-	fmt.Println("  - POST /trigger - Disparar ingestão de dados")
+	fmt.Println("  - POST /trigger - Disparar ingestão de dados (?async=true para execução em background, ?mode=full para carga completa, ?strict=true para tudo ou nada, ?upsert=true para atualizar pedidos existentes)")
+	fmt.Println("  - GET  /runs    - Histórico de execuções")
+	fmt.Println("  - GET  /runs/{id} - Detalhes de uma execução")
+	fmt.Println("  - GET  /jobs/{id} - Status de um job disparado via /trigger")
+	fmt.Println("  - GET  /rejected - Pedidos rejeitados na ingestão")
+	fmt.Println("  - POST /rejected/replay - Reprocessar pedidos rejeitados")
+	fmt.Println("  - POST /ingest/csv - Ingerir um arquivo CSV enviado no corpo (?delimiter=;&decimal=,&columns=campo=coluna)")
+	fmt.Println("  - POST /aggregate - Reconstruir todo aggregated.daily_metrics")
 
 	log.Fatal(http.ListenAndServe(":"+port, nil)) // inicia o servidor na porta ou encerra o programa se houver erro
 }
@@ -112,8 +286,14 @@ func healthHandler(w http.ResponseWriter, r *http.Request) { // w (response writ
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")                // define o header como application/json, informando que o conteúdo é JSON
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"}) // cria um encoder json que converte objeto Go em JSON e escreve em "w" a resposta "{"status": "healthy"}"
+	response := HealthResponse{Status: "healthy", Transformer: transformerBreaker.Status()}
+	if pipelineScheduler != nil {
+		status := pipelineScheduler.Status() // próxima e última execução agendada
+		response.Scheduler = &status
+	}
+
+	w.Header().Set("Content-Type", "application/json") // define o header como application/json, informando que o conteúdo é JSON
+	json.NewEncoder(w).Encode(response)                // cria um encoder json que converte objeto Go em JSON e escreve em "w" a resposta "{"status": "healthy"}"
 }
 
 func triggerHandler(w http.ResponseWriter, r *http.Request) { // função que dispara a execução do pipeline e escreve a resposta
@@ -124,16 +304,147 @@ func triggerHandler(w http.ResponseWriter, r *http.Request) { // função que di
 
 	fmt.Println("\n=== Pipeline disparado via HTTP ===")
 
+	async := r.URL.Query().Get("async") == "true"
+
+	opts := defaultRunOptions(triggerManual)
+
+	var err error
+	if opts.Strict, err = boolParam(r, "strict", opts.Strict); err != nil { // modo estrito: tudo ou nada
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Upsert, err = boolParam(r, "upsert", opts.Upsert); err != nil { // atualiza pedidos existentes
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if mode := r.URL.Query().Get("mode"); mode != "" { // incremental (padrão) ou full
+		if mode != modeIncremental && mode != modeFull {
+			http.Error(w, "mode deve ser incremental ou full", http.StatusBadRequest)
+			return
+		}
+		opts.Mode = mode
+	}
+
+	dispatchJob(w, opts, async)
+}
+
+// boolParam lê um parâmetro booleano da query string, usando def quando ausente
+func boolParam(r *http.Request, name string, def bool) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s deve ser true ou false", name)
+	}
+	return parsed, nil
+}
+
+// boolEnv lê uma variável de ambiente booleana (vazia = false), encerrando o programa se for inválida
+func boolEnv(name string) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return false
+	}
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("%s inválida: %q", name, v)
+	}
+	return parsed
+}
+
+// dispatchJob inicia um job e escreve a resposta: 202 no modo assíncrono, o resultado no modo síncrono,
+// ou 409 se já houver uma execução em andamento
+func dispatchJob(w http.ResponseWriter, opts RunOptions, async bool) {
+	job, err := jobs.start(opts) // todo disparo vira um job, consultável em GET /jobs/{id}
+	if errors.Is(err, errPipelineBusy) {
+		// Requisição síncrona aguarda e compartilha o resultado do job que já está em andamento neste processo,
+		// desde que ele tenha as mesmas opções; caso contrário (ou com arquivo enviado) recebe 409
+		if job != nil && !async && jobs.joinable(job, opts) {
+			fmt.Printf("⏳ Pipeline já em execução (job %s), aguardando resultado\n", job.ID)
+			<-job.done
+			writePipelineResponse(w, jobs.snapshot(job))
+			return
+		}
+
+		if job != nil {
+			current := jobs.snapshot(job)
+			writeBusyResponse(w, current.ID, current.RunID)
+		} else {
+			writeBusyResponse(w, "", runningRunID(db)) // execução em outra réplica, só conhecemos o registro em pipeline.runs
+		}
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(PipelineResponse{
+			Success:   false,
+			Message:   fmt.Sprintf("Erro ao iniciar pipeline: %v", err),
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	// Modo assíncrono: responde 202 imediatamente e executa o pipeline em background
+	if async {
+		go jobs.run(job)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted) // 202 Accepted: o pedido foi aceito, mas ainda não foi processado
+		json.NewEncoder(w).Encode(PipelineResponse{
+			Success:   true,
+			Message:   fmt.Sprintf("Pipeline enfileirado, acompanhe em /jobs/%s", job.ID),
+			JobID:     job.ID,
+			Timestamp: time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
 	// Executar pipeline
-	inserted, total, err := runPipeline() // executa o processo de ingestão de dados no PostgreSQL
+	writePipelineResponse(w, jobs.run(job)) // executa o processo de ingestão de dados no PostgreSQL e registra em pipeline.runs
+}
 
-	response := PipelineResponse{ //
-		Success:   err == nil, // sucess = true se err é nil
+// writeBusyResponse responde 409 informando o job e a execução em andamento, quando conhecidos
+func writeBusyResponse(w http.ResponseWriter, jobID string, runID int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict) // 409 Conflict: já existe uma execução em andamento
+	json.NewEncoder(w).Encode(PipelineResponse{
+		Success:   false,
+		Message:   "Pipeline já está em execução",
+		JobID:     jobID,
+		RunID:     runID,
 		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+// writePipelineResponse escreve o resultado de um job finalizado no formato PipelineResponse
+func writePipelineResponse(w http.ResponseWriter, finished Job) {
+	// O job aguardado pode ter encontrado o lock com outra sessão (ex.: execução de outra réplica, ou a
+	// anterior ainda liberando o lock): não é falha do pipeline, e sim uma execução já em andamento
+	if errors.Is(finished.err, errPipelineBusy) {
+		writeBusyResponse(w, "", runningRunID(db))
+		return
 	}
 
-	if err != nil {
-		response.Message = fmt.Sprintf("Erro ao executar pipeline: %v", err)
+	response := PipelineResponse{ //
+		Success:           finished.Status == jobStatusSucceeded,
+		RunID:             finished.RunID,
+		JobID:             finished.ID,
+		Inserted:          finished.Inserted,
+		Updated:           finished.Updated,
+		Skipped:           finished.Skipped,
+		Failed:            finished.Failed,
+		Total:             finished.Total,
+		Rejections:        finished.Rejections,
+		TransformerStatus: finished.TransformerStatus,
+		Timestamp:         time.Now().Format(time.RFC3339),
+	}
+
+	if !response.Success {
+		response.Message = fmt.Sprintf("Erro ao executar pipeline: %s", finished.Error)
 		w.Header().Set("Content-Type", "application/json") // informa que a resposta será JSIN, definindo o header como application/json
 		w.WriteHeader(http.StatusInternalServerError)      // escreve o status code 500 (Internal Server Error)
 		json.NewEncoder(w).Encode(response)                // cria um encoder json que converte objeto "response" de Go para JSON e escreve em "w" a resposta
@@ -141,43 +452,172 @@ func triggerHandler(w http.ResponseWriter, r *http.Request) { // função que di
 	}
 
 	response.Message = "Pipeline executado com sucesso"
-	response.Inserted = inserted
-	response.Total = total
 
 	w.Header().Set("Content-Type", "application/json") // informa que a resposta será JSON
 	json.NewEncoder(w).Encode(response)                // converte objeto para JSON
 }
 
-func runPipeline() (int, int, error) { // retorna 2 int e 1 error
-	// Buscar dados do Data Source
-	fmt.Println("\n📥 Buscando dados do Data Source...")
-	orders, err := fetchOrders(dataSourceURL) // fetchOrders é uma função que busca os pedidos da API do Data Source
-	if err != nil {
-		return 0, 0, fmt.Errorf("erro ao buscar pedidos: %w", err)
+func runPipeline(runID int64, opts RunOptions) (RunResult, error) { // retorna as contagens da execução e 1 error
+	result := RunResult{TransformerStatus: transformerNotCalled}
+
+	// Carga incremental: buscar apenas pedidos a partir do watermark salvo
+	var since time.Time
+	if opts.Mode == modeIncremental {
+		var err error
+		since, err = loadWatermark(db, source.Name()) // o watermark é guardado por fonte
+		if err != nil {
+			return result, err
+		}
+		if opts.Upsert && !since.IsZero() {
+			// O watermark segue created_at: pedidos anteriores a ele não voltam da fonte,
+			// então a atualização de status só alcança os pedidos dentro da janela revisitada
+			if upsertLookback > 0 {
+				since = since.Add(-upsertLookback)
+				fmt.Printf("🔁 Upsert incremental: revisitando %s antes do watermark\n", upsertLookback)
+			} else {
+				since = time.Time{}
+				fmt.Println("🔁 Upsert incremental sem PIPELINE_UPSERT_LOOKBACK: buscando todos os pedidos")
+			}
+		}
+		if !since.IsZero() {
+			result.Since = since.Format(time.RFC3339)
+			fmt.Printf("🔖 Carga incremental a partir de %s\n", result.Since)
+		}
 	}
-	fmt.Printf("✅ %d pedidos recebidos do Data Source\n", len(orders)) // qtd de pedidos recebidos
 
-	// Inserir dados no banco
-	fmt.Println("\n💾 Inserindo dados no PostgreSQL...")
-	inserted, err := insertOrders(db, orders) // insertOrders é uma função que insere os pedidos no banco de dados
+	// Os pedidos são validados e gravados em lotes, conforme chegam da fonte
+	ingest := newIngestion(db, runID, opts)
+	var replayIDs []int64 // ids em raw_data.rejected_orders sendo reprocessados
+	var fetchErr error
+	if opts.Trigger == triggerReplay {
+		// Reprocessamento: os pedidos vêm da tabela de rejeitados em vez do Data Source
+		fmt.Println("\n♻️  Carregando pedidos rejeitados pendentes...")
+		var orders []Order
+		var err error
+		replayIDs, orders, err = loadPendingRejections(db, opts.ReplayID)
+		if err != nil {
+			return result, err
+		}
+		fmt.Printf("✅ %d pedidos rejeitados para reprocessar\n", len(orders))
+		fetchErr = emitBatches(orders, ingest.add)
+	} else if opts.Trigger == triggerUpload {
+		// Arquivo enviado em POST /ingest/csv: os pedidos já foram lidos pelo handler
+		fmt.Printf("📄 %d pedidos do arquivo enviado\n", len(opts.Upload))
+		fetchErr = emitBatches(opts.Upload, ingest.add)
+	} else {
+		// Buscar dados da fonte configurada
+		fmt.Printf("\n📥 Buscando e gravando pedidos de %s...\n", source.Name())
+		fetchErr = source.Fetch(since, ingest.add, func(p fetchProgress) { // o conector busca os pedidos na API do Data Source ou em arquivos locais
+			result.Pages = p.Pages
+			result.SourceAttempts = p.Attempts
+			if p.Pages > 1 {
+				fmt.Printf("📄 Página %d: %d pedidos recebidos até agora\n", p.Pages, p.Orders)
+			}
+			if runID != 0 {
+				if err := updateRunProgress(db, runID, p.Pages, p.Orders); err != nil {
+					log.Printf("⚠️  %v", err) // o progresso é informativo, não interrompe a busca
+				}
+			}
+		})
+	}
+	err := ingest.finish(fetchErr)
+
+	// Mesmo se a execução falhar no meio, os lotes já confirmados são contabilizados
+	stats := ingest.stats
+	result.Fetched = ingest.fetched
+	result.Inserted = stats.Inserted
+	result.Updated = stats.Updated
+	result.Skipped = stats.Skipped
+	result.Failed = stats.Failed
+	if len(ingest.counts) > 0 {
+		result.Rejections = ingest.counts
+		fmt.Printf("⚠️  Pedidos reprovados na validação: %v\n", ingest.counts)
+	}
+	fmt.Printf("✅ %d pedidos recebidos, %d inseridos (%d atualizados, %d sem alteração, %d com erro)\n", result.Fetched, stats.Inserted, stats.Updated, stats.Skipped, stats.Failed) // qtd de pedidos inseridos
+
 	if err != nil {
-		return 0, len(orders), fmt.Errorf("erro ao inserir pedidos: %w", err)
+		// Lotes confirmados antes da falha já alteraram raw_data.orders; as métricas precisam refletir isso,
+		// pois a próxima execução os verá como já existentes e não chamará o transformer por eles
+		if stats.Inserted > 0 || stats.Updated > 0 {
+			runTransformer(&result, stats.Touched)
+		}
+		return result, err
 	}
-	fmt.Printf("✅ %d pedidos inseridos com sucesso\n", inserted) // qtd de pedidos inseridos
 
-	// Chamar transformer para agregar dados
-	if inserted > 0 {
-		fmt.Println("\n🔄 Chamando transformer para agregar dados...")
-		if err := callTransformer(transformerURL); err != nil { // callTransformer é uma função que chama o serviço transformer via HTTP
-			log.Printf("⚠️  Erro ao chamar transformer: %v", err)
-			// Não falhar o pipeline se o transformer falhar
-		} else {
-			fmt.Println("✅ Transformer executado com sucesso")
+	// Marcar os rejeitados como reprocessados; os que falharam de novo já foram gravados acima
+	if err := markReplayed(db, replayIDs, runID); err != nil {
+		return result, err
+	}
+
+	// Avançar o watermark até o maior created_at gravado nesta execução
+	// (exceto no reprocessamento e no envio de arquivo, que não vêm da fonte configurada)
+	if !stats.MaxCreatedAt.IsZero() && opts.Trigger != triggerReplay && opts.Trigger != triggerUpload {
+		if err := saveWatermark(db, source.Name(), stats.MaxCreatedAt, runID); err != nil {
+			return result, err
 		}
 	}
 
+	// Chamar transformer para agregar dados; pedidos atualizados também mudam as métricas das suas datas
+	if stats.Inserted > 0 || stats.Updated > 0 {
+		runTransformer(&result, stats.Touched)
+	}
+
 	fmt.Println("\n=== Pipeline concluído com sucesso ===")
-	return inserted, len(orders), nil
+	return result, nil
+}
+
+// runTransformer executa a agregação (transformer ou nativa) e registra o resultado na execução.
+// Não falha o pipeline se a agregação falhar, apenas registra na execução.
+// Com o circuito do transformer aberto, a chamada é pulada e a agregação fica pendente.
+// Apenas os grupos de daily_metrics tocados pela execução são recalculados, salvo quando
+// aggregationScope exige a reconstrução completa.
+func runTransformer(result *RunResult, touched map[aggregationKey]bool) {
+	native := aggregationMode == aggregationNative // sem dependência remota, o circuit breaker não se aplica
+	if !native && !transformerBreaker.allow() {
+		fmt.Println("\n⏭️  Circuito do transformer aberto, agregação pendente")
+		setAggregationStale(true) // os grupos desta execução ficam para a reconstrução completa
+		result.TransformerStatus = transformerPending
+		return
+	}
+
+	keys := aggregationScope(touched)
+	scope := "completa"
+	if keys != nil {
+		scope = fmt.Sprintf("incremental, %d grupos", len(keys))
+	}
+	if native {
+		fmt.Printf("\n🔄 Agregando dados no próprio pipeline (%s)...\n", scope)
+	} else {
+		fmt.Printf("\n🔄 Chamando transformer para agregar dados (%s)...\n", scope)
+	}
+	attempts, err := aggregate(keys) // chama o serviço transformer via HTTP ou agrega direto no banco
+	result.TransformerAttempts = attempts
+	if err != nil {
+		log.Printf("⚠️  Erro na agregação: %v", err)
+		if !native {
+			transformerBreaker.failure()
+		}
+		setAggregationStale(true)
+		result.TransformerStatus = transformerFailed
+		result.TransformerError = err.Error()
+		return
+	}
+	if !native {
+		transformerBreaker.success()
+	}
+	fmt.Println("✅ Agregação executada com sucesso")
+	result.TransformerStatus = transformerSucceeded
+	if keys != nil {
+		return
+	}
+	setAggregationStale(false)
+
+	// A reconstrução completa recalcula todas as métricas, então também resolve o que ficou pendente em execuções anteriores
+	if resolved, err := resolvePendingAggregation(db); err != nil {
+		log.Printf("⚠️  %v", err)
+	} else if resolved > 0 {
+		fmt.Printf("✅ %d execuções com agregação pendente atualizadas\n", resolved)
+	}
 }
 
 // setupDatabase cria o schema raw_data e a tabela orders se não existirem
@@ -206,96 +646,280 @@ func setupDatabase(db *sql.DB) error {
 		return fmt.Errorf("erro ao criar tabela: %w", err)
 	}
 
+	// A série temporal do backend2-api (por hora ou em fuso diferente de UTC) filtra os pedidos brutos por created_at
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS orders_created_at_idx ON raw_data.orders (created_at)"); err != nil {
+		return fmt.Errorf("erro ao criar índice de raw_data.orders: %w", err)
+	}
+
+	// Criar tabela de histórico de execuções do pipeline
+	if err := setupRunsTable(db); err != nil {
+		return err
+	}
+
+	// Criar tabela de watermarks da carga incremental
+	if err := setupWatermarkTable(db); err != nil {
+		return err
+	}
+
+	// Criar tabela de pedidos rejeitados (dead letter)
+	if err := setupRejectedTable(db); err != nil {
+		return err
+	}
+
+	// Criar tabela de histórico de mudanças de status
+	if err := setupStatusHistoryTable(db); err != nil {
+		return err
+	}
+
+	// Criar o registro de agregação pendente (reconstrução completa na próxima execução)
+	if err := setupAggregationStateTable(db); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// fetchOrders busca os pedidos da API do Data Source
-func fetchOrders(url string) ([]Order, error) {
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+// fetchOrders busca os pedidos da API do Data Source; ctx limita a busca inteira, inclusive a leitura do corpo.
+// Se since não for zero, envia ?since= para que a fonte retorne apenas pedidos com created_at >= since.
+// O array da resposta é decodificado pedido a pedido e entregue a emit em lotes de batchSize,
+// então a memória usada não depende do tamanho da resposta.
+func fetchOrders(ctx context.Context, sourceURL string, since time.Time, emit func([]Order) error, progress func(fetchProgress)) error {
+	// Sem Timeout no client: uma resposta grande pode levar mais que 30s para ser lida por completo;
+	// o limite total é o de ctx (PIPELINE_FETCH_TIMEOUT)
+	client := &http.Client{Transport: sourceTransport}
+
+	if !since.IsZero() {
+		u, err := url.Parse(sourceURL)
+		if err != nil {
+			return fmt.Errorf("URL do Data Source inválida: %w", err)
+		}
+		query := u.Query() // preserva parâmetros já presentes na URL
+		query.Set("since", since.UTC().Format(time.RFC3339))
+		u.RawQuery = query.Encode()
+		sourceURL = u.String()
 	}
 
-	resp, err := client.Get(url) // faz uma requisição GET para a URL para obter os dados do Data Source
+	// Só a requisição é repetida; depois que pedidos foram entregues a emit, uma falha na leitura encerra a busca
+	var resp *http.Response
+	attempts, err := sourceRetry.do("Data Source", func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+		if err != nil {
+			return fmt.Errorf("erro ao criar requisição HTTP: %w", err)
+		}
+		r, err := client.Do(req) // faz uma requisição GET para a URL para obter os dados do Data Source
+		if err != nil {
+			if ctx.Err() != nil {
+				return context.Cause(ctx) // tempo total esgotado: não adianta tentar de novo
+			}
+			return fmt.Errorf("erro ao fazer requisição HTTP: %w", err)
+		}
+		if r.StatusCode != http.StatusOK { // status ok = 200
+			r.Body.Close()
+			return newStatusError(r)
+		}
+		resp = r
+		return nil
+	})
+
 	if err != nil {
-		return nil, fmt.Errorf("erro ao fazer requisição HTTP: %w", err)
+		if progress != nil {
+			progress(fetchProgress{Attempts: attempts}) // registra as tentativas feitas mesmo sem nenhum pedido recebido
+		}
+		return err
+	}
+	report := func(orders int) {
+		if progress != nil {
+			progress(fetchProgress{Pages: 1, Orders: orders, Attempts: attempts})
+		}
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK { // status ok = 200
-		return nil, fmt.Errorf("status code não OK: %d", resp.StatusCode)
+	return streamOrders(resp.Body, emit, report)
+}
+
+// streamOrders decodifica um array JSON de pedidos token a token, entregando lotes de batchSize a emit
+func streamOrders(r io.Reader, emit func([]Order) error, progress func(orders int)) error {
+	decoder := json.NewDecoder(r)
+
+	token, err := decoder.Token() // o primeiro token deve ser o início do array
+	if err != nil {
+		return fmt.Errorf("erro ao decodificar JSON: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("erro ao decodificar JSON: esperado um array de pedidos, recebido %v", token)
+	}
+
+	total := 0
+	flush := func(batch []Order) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		total += len(batch)
+		if err := emit(batch); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(total)
+		}
+		return nil
+	}
+
+	batch := make([]Order, 0, batchSize)
+	for decoder.More() {
+		var order Order // Order é uma ficha de pedido; cada elemento do array é decodificado de JSON para Go separadamente
+		if err := decoder.Decode(&order); err != nil {
+			return fmt.Errorf("erro ao decodificar pedido %d: %w", total+len(batch)+1, err)
+		}
+		batch = append(batch, order)
+
+		if len(batch) == batchSize {
+			if err := flush(batch); err != nil {
+				return err
+			}
+			batch = make([]Order, 0, batchSize) // novo lote, para não alterar o que já foi entregue a emit
+		}
+	}
+	if err := flush(batch); err != nil {
+		return err
 	}
 
-	var orders []Order                                                 // orders é um slice de Order. Order é uma ficha de pedido, e []Order é uma pasta com várias fichas
-	if err := json.NewDecoder(resp.Body).Decode(&orders); err != nil { // decodifica o JSON da resposta, passando de JSON para Go
-		return nil, fmt.Errorf("erro ao decodificar JSON: %w", err)
+	if _, err := decoder.Token(); err != nil { // fim do array
+		return fmt.Errorf("erro ao decodificar JSON: %w", err)
 	}
+	return nil
+}
+
+// insertStats contabiliza o resultado da inserção de um lote de pedidos
+type insertStats struct {
+	Inserted int // pedidos novos
+	Updated  int // pedidos existentes com status, value ou payment_method alterados (modo upsert)
+	Skipped  int // pedidos já existentes e sem alteração
+	Failed   int // pedidos descartados por erro de parse ou de inserção
 
-	return orders, nil // retorna os pedidos em formato Go ou erro se houver
+	MaxCreatedAt time.Time               // maior created_at entre os pedidos gravados ou já existentes
+	Rejected     []rejection             // pedidos descartados, gravados em raw_data.rejected_orders
+	Touched      map[aggregationKey]bool // grupos de daily_metrics que precisam ser recalculados
 }
 
-// insertOrders insere os pedidos no banco de dados
-func insertOrders(db *sql.DB, orders []Order) (int, error) {
-	if len(orders) == 0 {
-		return 0, nil
+// insertOrders insere os pedidos já validados no banco de dados em lotes de batchSize via COPY,
+// cada lote em uma transação própria (modo tolerante; o modo estrito usa strictCopy).
+// No modo upsert, pedidos existentes têm status, value e payment_method atualizados quando diferem.
+func insertOrders(db *sql.DB, runID int64, valid []parsedOrder, opts RunOptions) (insertStats, error) {
+	var stats insertStats
+
+	for start := 0; start < len(valid); start += batchSize {
+		batch := valid[start:min(start+batchSize, len(valid))]
+
+		batchStats, err := copyBatch(db, runID, batch, opts.Upsert)
+		if err != nil {
+			// Um pedido inválido derruba o COPY inteiro; refazer o lote pedido a pedido para isolar o problema
+			log.Printf("⚠️  Erro no COPY do lote (%v), inserindo pedido a pedido", err)
+			batchStats, err = insertRowByRow(db, runID, batch, opts.Upsert)
+			if err != nil {
+				return stats, err
+			}
+		}
+		stats.add(batchStats)
 	}
 
-	// Preparar statement (stmt) SQL para inserção, cria um template SQL que será executado posteriormente com os valores passados
-	stmt, err := db.Prepare(` 
-		INSERT INTO raw_data.orders (order_id, created_at, status, value, payment_method)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (order_id) DO NOTHING
+	return stats, nil
+}
+
+// insertRowByRow insere um pedido por vez, registrando e pulando os que falharem
+func insertRowByRow(db *sql.DB, runID int64, orders []parsedOrder, upsert bool) (insertStats, error) {
+	var stats insertStats
+
+	// Preparar statement (stmt) SQL para inserção, cria um template SQL que será executado posteriormente com os valores passados.
+	// RETURNING (xmax = 0) é true para linhas inseridas e false para atualizadas; sem linha retornada, nada mudou.
+	// A mudança de status, se houver, é registrada no histórico no mesmo comando.
+	// Também retorna o grupo de daily_metrics do pedido gravado e, se ele foi atualizado, o grupo anterior.
+	stmt, err := db.Prepare(`
+		WITH previous AS (
+			SELECT status, payment_method FROM raw_data.orders WHERE order_id = $1
+		), upserted AS (
+			INSERT INTO raw_data.orders AS o (order_id, created_at, status, value, payment_method)
+			VALUES ($1, $2, $3, $4, $5)
+			` + onConflictClause(upsert) + `
+			RETURNING o.created_at, o.status, o.payment_method, (xmax = 0) AS inserted
+		), history AS (
+			INSERT INTO raw_data.order_status_history (order_id, old_status, new_status, run_id)
+			SELECT $1, p.status, u.status, $6::BIGINT
+			FROM upserted u, previous p
+			WHERE NOT u.inserted AND p.status IS DISTINCT FROM u.status
+		)
+		SELECT u.inserted, TO_CHAR(u.created_at, 'YYYY-MM-DD'), u.status, u.payment_method, p.status, p.payment_method
+		FROM upserted u
+		LEFT JOIN previous p ON true
 	`)
 	if err != nil {
-		return 0, fmt.Errorf("erro ao preparar statement: %w", err)
+		return stats, fmt.Errorf("erro ao preparar statement: %w", err)
 	}
 	defer stmt.Close()
 
-	inserted := 0
 	for _, order := range orders { // para cada pedido, executa o statement preparado
-		// Converter created_at de string para time.Time
-		createdAt, err := time.Parse(time.RFC3339, order.CreatedAt) // converte a string para time.Time
-		if err != nil {
-			log.Printf("⚠️  Erro ao parsear created_at '%s': %v", order.CreatedAt, err) // parsear é transformar texto bruto em dado estruturado
-			continue
-		}
-
 		// Inserir no banco
-		result, err := stmt.Exec( // executa o statement preparado, ou seja, preenche os valores do template SQL com os valores do pedido
+		var inserted bool
+		var key aggregationKey
+		var previousStatus, previousPaymentMethod sql.NullString
+		err := stmt.QueryRow( // executa o statement preparado, ou seja, preenche os valores do template SQL com os valores do pedido
 			order.OrderID,
-			createdAt,
+			order.CreatedAtTime,
 			order.Status,
 			order.Value,
 			order.PaymentMethod,
-		)
-		if err != nil {
+			nullRunID(runID),
+		).Scan(&inserted, &key.Date, &key.Status, &key.PaymentMethod, &previousStatus, &previousPaymentMethod)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			stats.Skipped++ // pedido já existia e não mudou: nenhuma linha retornada
+		case err != nil:
 			log.Printf("⚠️  Erro ao inserir pedido %s: %v", order.OrderID, err)
+			stats.reject(order.Order, fmt.Sprintf("erro ao inserir: %v", err))
 			continue
+		case inserted:
+			stats.Inserted++
+			stats.touch(key)
+		default:
+			stats.Updated++
+			previous := key // created_at não muda no upsert, então o grupo anterior é do mesmo dia
+			previous.Status, previous.PaymentMethod = previousStatus.String, previousPaymentMethod.String
+			stats.touch(key, previous)
 		}
 
-		rowsAffected, _ := result.RowsAffected() // obtém o número de linhas afetadas pela execução do statement
-		if rowsAffected > 0 {
-			inserted++
+		if order.CreatedAtTime.After(stats.MaxCreatedAt) {
+			stats.MaxCreatedAt = order.CreatedAtTime
 		}
 	}
 
-	return inserted, nil
+	return stats, nil
 }
 
-// callTransformer chama o serviço transformer via HTTP
-func callTransformer(url string) error {
+// callTransformer chama o serviço transformer via HTTP, repetindo conforme transformerRetry.
+// Com keys diferente de nil, envia os grupos no corpo para o transformer recalcular só eles.
+// Retorna o número de tentativas feitas.
+func callTransformer(url string, keys []aggregationKey) (int, error) {
 	client := &http.Client{ // acessa o endpoint do transformer via HTTP
 		Timeout: 30 * time.Second,
 	}
 
-	resp, err := client.Post(url, "application/json", nil) // faz uma requisição POST (pois executa transformação nos dados) para a URL
-	if err != nil {
-		return fmt.Errorf("erro ao fazer requisição HTTP: %w", err)
+	var payload []byte // sem corpo, o transformer reconstrói todas as métricas
+	if keys != nil {
+		var err error
+		if payload, err = json.Marshal(map[string][]aggregationKey{"keys": keys}); err != nil {
+			return 0, fmt.Errorf("erro ao serializar grupos: %w", err)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("status code não OK: %d", resp.StatusCode)
-	}
+	return transformerRetry.do("Transformer", func() error {
+		resp, err := client.Post(url, "application/json", bytes.NewReader(payload)) // faz uma requisição POST (pois executa transformação nos dados) para a URL
+		if err != nil {
+			return fmt.Errorf("erro ao fazer requisição HTTP: %w", err)
+		}
+		defer resp.Body.Close()
 
-	return nil
+		if resp.StatusCode != http.StatusOK {
+			return newStatusError(resp)
+		}
+		return nil
+	})
 }
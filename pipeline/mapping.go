@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Regras de mapeamento; contadas junto com as de validação em RunResult.Rejections
+const (
+	ruleUnmappedStatus        = "unmapped_status"         // status sem correspondência no arquivo de mapeamento
+	ruleUnmappedPaymentMethod = "unmapped_payment_method" // método de pagamento sem correspondência no arquivo de mapeamento
+)
+
+// valueMapping normaliza as grafias de status e método de pagamento de cada fonte para o vocabulário canônico
+type valueMapping struct {
+	Status         map[string]string // chave normalizada (minúsculas, sem espaços nas pontas) -> valor canônico
+	PaymentMethod  map[string]string
+	RejectUnmapped bool // true: valores sem mapeamento são rejeitados; false: passam como vieram
+}
+
+// mappingFile é o formato do arquivo apontado por PIPELINE_MAPPING_FILE, ex.:
+// {"status": {"APPROVED": "approved", "paid": "approved"}, "payment_method": {"cartao": "credit_card"}}
+type mappingFile struct {
+	Status        map[string]string `json:"status"`
+	PaymentMethod map[string]string `json:"payment_method"`
+}
+
+var orderMapping *valueMapping // nil quando PIPELINE_MAPPING_FILE não está configurada
+
+// loadMapping lê o arquivo de mapeamento. Os próprios valores canônicos também são aceitos como entrada.
+func loadMapping(path string, rejectUnmapped bool) (*valueMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler arquivo de mapeamento: %w", err)
+	}
+
+	var file mappingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar arquivo de mapeamento %s: %w", path, err)
+	}
+
+	return &valueMapping{
+		Status:         normalizeKeys(file.Status),
+		PaymentMethod:  normalizeKeys(file.PaymentMethod),
+		RejectUnmapped: rejectUnmapped,
+	}, nil
+}
+
+// normalizeKeys indexa o mapeamento pela forma normalizada da chave e inclui cada valor canônico como chave de si mesmo
+func normalizeKeys(raw map[string]string) map[string]string {
+	normalized := make(map[string]string, len(raw))
+	for _, canonical := range raw {
+		normalized[mappingKey(canonical)] = canonical
+	}
+	for from, to := range raw {
+		normalized[mappingKey(from)] = to // entradas explícitas têm precedência
+	}
+	return normalized
+}
+
+// mappingKey ignora maiúsculas/minúsculas e espaços nas pontas, então "APPROVED" e " approved" são a mesma chave
+func mappingKey(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// normalize traduz status e método de pagamento do pedido.
+// Retorna a regra violada e o motivo quando um valor não tem mapeamento e RejectUnmapped está ativo.
+func (m *valueMapping) normalize(order Order) (Order, string, string) {
+	if canonical, ok := m.Status[mappingKey(order.Status)]; ok {
+		order.Status = canonical
+	} else if m.RejectUnmapped {
+		return order, ruleUnmappedStatus, fmt.Sprintf("status %q sem mapeamento", order.Status)
+	}
+
+	if canonical, ok := m.PaymentMethod[mappingKey(order.PaymentMethod)]; ok {
+		order.PaymentMethod = canonical
+	} else if m.RejectUnmapped {
+		return order, ruleUnmappedPaymentMethod, fmt.Sprintf("payment_method %q sem mapeamento", order.PaymentMethod)
+	}
+
+	return order, "", ""
+}
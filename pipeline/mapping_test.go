@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMappingNormalize(t *testing.T) {
+	mapping := &valueMapping{
+		Status:        normalizeKeys(map[string]string{"APPROVED": "approved", "paid": "approved", "Cancelado": "cancelled"}),
+		PaymentMethod: normalizeKeys(map[string]string{"cartao": "credit_card"}),
+	}
+
+	tests := []struct {
+		name           string
+		rejectUnmapped bool
+		in             Order
+		want           Order
+		wantRule       string
+	}{
+		{"maiúsculas e espaços", false, Order{Status: " Paid ", PaymentMethod: "CARTAO"}, Order{Status: "approved", PaymentMethod: "credit_card"}, ""},
+		{"valor canônico mapeia para si mesmo", false, Order{Status: "cancelled", PaymentMethod: "credit_card"}, Order{Status: "cancelled", PaymentMethod: "credit_card"}, ""},
+		{"sem mapeamento passa como veio", false, Order{Status: "refunded", PaymentMethod: "pix"}, Order{Status: "refunded", PaymentMethod: "pix"}, ""},
+		{"status sem mapeamento rejeitado", true, Order{Status: "refunded", PaymentMethod: "cartao"}, Order{}, ruleUnmappedStatus},
+		{"payment_method sem mapeamento rejeitado", true, Order{Status: "paid", PaymentMethod: "pix"}, Order{}, ruleUnmappedPaymentMethod},
+	}
+
+	for _, tt := range tests {
+		mapping.RejectUnmapped = tt.rejectUnmapped
+		got, rule, reason := mapping.normalize(tt.in)
+		if rule != tt.wantRule {
+			t.Errorf("%s: regra = %q (%s), esperado %q", tt.name, rule, reason, tt.wantRule)
+			continue
+		}
+		if rule == "" && got != tt.want {
+			t.Errorf("%s: normalize = %+v, esperado %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadMapping(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mappings.json")
+	if err := os.WriteFile(path, []byte(`{"status": {"PAGO": "approved"}, "payment_method": {"Cartão": "credit_card"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mapping, err := loadMapping(path, true)
+	if err != nil {
+		t.Fatalf("loadMapping: %v", err)
+	}
+	if !mapping.RejectUnmapped || mapping.Status["pago"] != "approved" || mapping.PaymentMethod["cartão"] != "credit_card" {
+		t.Errorf("mapeamento carregado = %+v", mapping)
+	}
+
+	invalid := filepath.Join(dir, "invalido.json")
+	if err := os.WriteFile(invalid, []byte(`{"status": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadMapping(invalid, false); err == nil {
+		t.Error("loadMapping aceitou um JSON inválido")
+	}
+	if _, err := loadMapping(filepath.Join(dir, "ausente.json"), false); err == nil {
+		t.Error("loadMapping aceitou um arquivo inexistente")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Estilos de paginação aceitos em PIPELINE_PAGINATION
+const (
+	paginationNone   = "none"   // a fonte retorna todos os pedidos em uma única resposta (padrão)
+	paginationPage   = "page"   // ?page=N&limit=M, com page começando em 1
+	paginationOffset = "offset" // ?offset=N&limit=M
+	paginationCursor = "cursor" // segue o link "next" (corpo ou cabeçalho Link) ou envia ?cursor= com o next_cursor recebido
+)
+
+// paginationConfig define como percorrer as páginas da fonte HTTP
+type paginationConfig struct {
+	Style       string
+	PageSize    int
+	PageParam   string
+	LimitParam  string
+	OffsetParam string
+	CursorParam string
+	MaxPages    int // proteção contra fontes que nunca sinalizam o fim
+}
+
+var pagination = paginationConfig{
+	Style:       paginationNone,
+	PageSize:    500,
+	PageParam:   "page",
+	LimitParam:  "limit",
+	OffsetParam: "offset",
+	CursorParam: "cursor",
+	MaxPages:    10000,
+}
+
+// loadPaginationConfig aplica PIPELINE_PAGINATION, PIPELINE_PAGE_SIZE, PIPELINE_MAX_PAGES
+// e PIPELINE_{PAGE,LIMIT,OFFSET,CURSOR}_PARAM sobre os padrões
+func loadPaginationConfig() (paginationConfig, error) {
+	c := pagination
+
+	if v := os.Getenv("PIPELINE_PAGINATION"); v != "" {
+		switch v {
+		case paginationNone, paginationPage, paginationOffset, paginationCursor:
+			c.Style = v
+		default:
+			return c, fmt.Errorf("PIPELINE_PAGINATION desconhecida: %q (use none, page, offset ou cursor)", v)
+		}
+	}
+	if v := os.Getenv("PIPELINE_PAGE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return c, fmt.Errorf("PIPELINE_PAGE_SIZE inválida: %q", v)
+		}
+		c.PageSize = n
+	}
+	if v := os.Getenv("PIPELINE_MAX_PAGES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return c, fmt.Errorf("PIPELINE_MAX_PAGES inválida: %q", v)
+		}
+		c.MaxPages = n
+	}
+
+	params := map[string]*string{
+		"PIPELINE_PAGE_PARAM":   &c.PageParam,
+		"PIPELINE_LIMIT_PARAM":  &c.LimitParam,
+		"PIPELINE_OFFSET_PARAM": &c.OffsetParam,
+		"PIPELINE_CURSOR_PARAM": &c.CursorParam,
+	}
+	for name, param := range params {
+		if v := os.Getenv(name); v != "" {
+			*param = v
+		}
+	}
+
+	return c, nil
+}
+
+// page é uma página recebida da fonte
+type page struct {
+	Orders     []Order
+	NextURL    string // link para a próxima página (corpo "next" ou cabeçalho Link rel="next")
+	NextCursor string // cursor da próxima página (corpo "next_cursor")
+}
+
+// pageEnvelope é o formato de resposta em objeto; respostas em array são tratadas como páginas sem link
+type pageEnvelope struct {
+	Orders     []Order `json:"orders"`
+	Data       []Order `json:"data"` // nome alternativo usado por algumas APIs
+	Next       string  `json:"next"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+// fetchPaginated percorre as páginas da fonte até o fim, entregando cada página a emit assim que é recebida
+func fetchPaginated(ctx context.Context, sourceURL string, since time.Time, c paginationConfig, emit func([]Order) error, progress func(fetchProgress)) error {
+	client := &http.Client{
+		Transport: sourceTransport,
+		Timeout:   30 * time.Second, // por página; a carga inteira é limitada por ctx
+	}
+
+	base, err := url.Parse(sourceURL)
+	if err != nil {
+		return fmt.Errorf("URL do Data Source inválida: %w", err)
+	}
+	query := base.Query() // preserva parâmetros já presentes na URL
+	if !since.IsZero() {
+		query.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	query.Set(c.LimitParam, strconv.Itoa(c.PageSize))
+
+	total := 0    // pedidos recebidos até agora; só a página atual fica em memória
+	attempts := 0 // requisições feitas em todas as páginas, incluindo novas tentativas
+	next := ""    // no estilo cursor, URL da próxima página
+	for pageNumber := 1; ; pageNumber++ {
+		if pageNumber > c.MaxPages {
+			return fmt.Errorf("limite de %d páginas atingido sem o fim da fonte", c.MaxPages)
+		}
+
+		pageURL := next
+		if pageURL == "" {
+			switch c.Style {
+			case paginationPage:
+				query.Set(c.PageParam, strconv.Itoa(pageNumber))
+			case paginationOffset:
+				query.Set(c.OffsetParam, strconv.Itoa(total))
+			}
+			u := *base
+			u.RawQuery = query.Encode()
+			pageURL = u.String()
+		}
+
+		// A página é lida por inteiro antes de ser entregue, então a busca dela pode ser repetida com segurança
+		var p page
+		n, err := sourceRetry.do(fmt.Sprintf("Data Source (página %d)", pageNumber), func() error {
+			var err error
+			p, err = fetchPage(ctx, client, pageURL)
+			if err != nil && ctx.Err() != nil {
+				return context.Cause(ctx) // tempo total esgotado: não adianta tentar de novo
+			}
+			return err
+		})
+		attempts += n
+		if err != nil {
+			if progress != nil {
+				progress(fetchProgress{Pages: pageNumber - 1, Orders: total, Attempts: attempts})
+			}
+			return fmt.Errorf("página %d: %w", pageNumber, err)
+		}
+		total += len(p.Orders)
+		if progress != nil {
+			progress(fetchProgress{Pages: pageNumber, Orders: total, Attempts: attempts})
+		}
+		if err := emitBatches(p.Orders, emit); err != nil {
+			return err
+		}
+
+		if c.Style != paginationCursor {
+			if len(p.Orders) < c.PageSize { // página incompleta (ou vazia) é a última
+				return nil
+			}
+			continue
+		}
+
+		switch {
+		case p.NextURL != "":
+			ref, err := url.Parse(p.NextURL)
+			if err != nil {
+				return fmt.Errorf("página %d: link next inválido: %w", pageNumber, err)
+			}
+			next = base.ResolveReference(ref).String() // aceita links relativos
+		case p.NextCursor != "":
+			query.Set(c.CursorParam, p.NextCursor)
+			next = ""
+		default:
+			return nil // sem próxima página
+		}
+		if next == pageURL {
+			return fmt.Errorf("página %d: a fonte devolveu o mesmo link como próxima página", pageNumber)
+		}
+	}
+}
+
+// fetchPage busca uma página; o corpo pode ser um array de pedidos ou um objeto com os pedidos e o link da próxima página
+func fetchPage(ctx context.Context, client *http.Client, pageURL string) (page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return page{}, fmt.Errorf("erro ao criar requisição HTTP: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return page{}, fmt.Errorf("erro ao fazer requisição HTTP: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return page{}, newStatusError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return page{}, fmt.Errorf("erro ao ler resposta: %w", err)
+	}
+
+	p := page{NextURL: linkNext(resp.Header.Get("Link"))}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		var envelope pageEnvelope
+		if err := json.Unmarshal(trimmed, &envelope); err != nil {
+			return page{}, fmt.Errorf("erro ao decodificar JSON: %w", err)
+		}
+		p.Orders = envelope.Orders
+		if p.Orders == nil {
+			p.Orders = envelope.Data
+		}
+		if envelope.Next != "" {
+			p.NextURL = envelope.Next
+		}
+		p.NextCursor = envelope.NextCursor
+		return p, nil
+	}
+
+	if err := json.Unmarshal(body, &p.Orders); err != nil {
+		return page{}, fmt.Errorf("erro ao decodificar JSON: %w", err)
+	}
+	return p, nil
+}
+
+// linkNext extrai a URL com rel="next" de um cabeçalho Link (RFC 8288), ex.: <http://fonte/?cursor=abc>; rel="next"
+func linkNext(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "rel") && strings.Trim(value, `"`) == "next" {
+				return target[1 : len(target)-1]
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestLinkNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"vazio", "", ""},
+		{"apenas next", `<http://fonte/?cursor=abc>; rel="next"`, "http://fonte/?cursor=abc"},
+		{"rel sem aspas", `<http://fonte/?page=2>; rel=next`, "http://fonte/?page=2"},
+		{"REL em maiúsculas", `<http://fonte/?page=2>; REL="next"`, "http://fonte/?page=2"},
+		{"vários links", `<http://fonte/?page=1>; rel="prev", <http://fonte/?page=3>; rel="next"`, "http://fonte/?page=3"},
+		{"outros parâmetros", `<http://fonte/?page=3>; title="próxima"; rel="next"`, "http://fonte/?page=3"},
+		{"sem next", `<http://fonte/?page=1>; rel="prev"`, ""},
+		{"sem os sinais de menor e maior", `http://fonte/?page=3; rel="next"`, ""},
+		{"link relativo", `</orders?cursor=10>; rel="next"`, "/orders?cursor=10"},
+	}
+
+	for _, tt := range tests {
+		if got := linkNext(tt.header); got != tt.want {
+			t.Errorf("%s: linkNext(%q) = %q, esperado %q", tt.name, tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// rejection é um pedido descartado durante a ingestão, com o motivo
+type rejection struct {
+	Order  Order
+	Reason string
+}
+
+// RejectedOrder representa um registro de raw_data.rejected_orders
+type RejectedOrder struct {
+	ID          int64           `json:"id"`
+	RunID       int64           `json:"run_id,omitempty"`
+	OrderID     string          `json:"order_id"`
+	Payload     json.RawMessage `json:"payload"` // pedido como recebido da fonte
+	Reason      string          `json:"reason"`
+	RejectedAt  string          `json:"rejected_at"`
+	ReplayedAt  string          `json:"replayed_at,omitempty"`   // preenchido quando o pedido é reprocessado
+	ReplayRunID int64           `json:"replay_run_id,omitempty"` // execução que reprocessou o pedido
+}
+
+// RejectedOrdersResponse representa a resposta do endpoint GET /rejected
+type RejectedOrdersResponse struct {
+	Rejected []RejectedOrder `json:"rejected"`
+}
+
+// setupRejectedTable cria a tabela de pedidos rejeitados (dead letter) se não existir
+func setupRejectedTable(db *sql.DB) error {
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS raw_data.rejected_orders (
+			id BIGSERIAL PRIMARY KEY,
+			run_id BIGINT,
+			order_id VARCHAR(255),
+			payload JSONB NOT NULL,
+			reason TEXT NOT NULL,
+			rejected_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			replayed_at TIMESTAMPTZ,
+			replay_run_id BIGINT
+		)
+	`
+
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("erro ao criar tabela raw_data.rejected_orders: %w", err)
+	}
+
+	// Um mesmo pedido rejeitado pelo mesmo motivo fica pendente uma única vez, mesmo que volte em
+	// cargas completas, upserts com janela ou na borda do watermark
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass('raw_data.rejected_orders_pending_key') IS NOT NULL").Scan(&exists); err != nil {
+		return fmt.Errorf("erro ao verificar índice de raw_data.rejected_orders: %w", err)
+	}
+	if !exists {
+		// Tabelas de versões anteriores podem ter duplicatas pendentes; mantém a mais antiga de cada uma
+		result, err := db.Exec(`
+			DELETE FROM raw_data.rejected_orders dup
+			USING raw_data.rejected_orders kept
+			WHERE dup.replayed_at IS NULL AND kept.replayed_at IS NULL
+				AND dup.payload = kept.payload AND dup.reason = kept.reason
+				AND dup.id > kept.id
+		`)
+		if err != nil {
+			return fmt.Errorf("erro ao remover rejeitados duplicados: %w", err)
+		}
+		if removed, _ := result.RowsAffected(); removed > 0 {
+			fmt.Printf("🧹 %d pedidos rejeitados duplicados removidos\n", removed)
+		}
+	}
+	if _, err := db.Exec(pendingRejectionIndexSQL); err != nil {
+		return fmt.Errorf("erro ao criar índice de raw_data.rejected_orders: %w", err)
+	}
+	return nil
+}
+
+// pendingRejectionIndexSQL cria a chave dos rejeitados pendentes: o pedido como recebido e o motivo.
+// O payload entra pelo hash, para o índice não depender do tamanho do pedido.
+const pendingRejectionIndexSQL = `
+	CREATE UNIQUE INDEX IF NOT EXISTS rejected_orders_pending_key
+	ON raw_data.rejected_orders (md5(payload::text), reason)
+	WHERE replayed_at IS NULL
+`
+
+// saveRejections grava os pedidos rejeitados de uma execução. Um pedido que já está pendente com o
+// mesmo motivo não é duplicado: o registro existente passa a apontar para esta execução (a última que o rejeitou).
+func saveRejections(db *sql.DB, runID int64, rejections []rejection) error {
+	if len(rejections) == 0 {
+		return nil
+	}
+
+	var run sql.NullInt64
+	if runID != 0 {
+		run = sql.NullInt64{Int64: runID, Valid: true}
+	}
+
+	stmt, err := db.Prepare(`
+		INSERT INTO raw_data.rejected_orders (run_id, order_id, payload, reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (md5(payload::text), reason) WHERE replayed_at IS NULL
+		DO UPDATE SET run_id = EXCLUDED.run_id
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao preparar gravação de rejeitados: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, rej := range rejections {
+		payload, err := json.Marshal(rej.Order)
+		if err != nil {
+			return fmt.Errorf("erro ao serializar pedido %s: %w", rej.Order.OrderID, err)
+		}
+		if _, err := stmt.Exec(run, rej.Order.OrderID, string(payload), rej.Reason); err != nil {
+			return fmt.Errorf("erro ao gravar pedido rejeitado %s: %w", rej.Order.OrderID, err)
+		}
+	}
+	return nil
+}
+
+// loadPendingRejections carrega os pedidos rejeitados ainda não reprocessados.
+// Se id for diferente de zero, carrega apenas aquele registro.
+func loadPendingRejections(db *sql.DB, id int64) ([]int64, []Order, error) {
+	query := "SELECT id, payload FROM raw_data.rejected_orders WHERE replayed_at IS NULL"
+	args := []interface{}{}
+	if id != 0 {
+		query += " AND id = $1"
+		args = append(args, id)
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao carregar pedidos rejeitados: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var orders []Order
+	for rows.Next() {
+		var rejectedID int64
+		var payload []byte
+		if err := rows.Scan(&rejectedID, &payload); err != nil {
+			return nil, nil, err
+		}
+
+		var order Order
+		if err := json.Unmarshal(payload, &order); err != nil {
+			log.Printf("⚠️  Payload do rejeitado %d não pôde ser lido: %v", rejectedID, err)
+			continue
+		}
+		ids = append(ids, rejectedID)
+		orders = append(orders, order)
+	}
+	return ids, orders, rows.Err()
+}
+
+// markReplayed registra que os pedidos rejeitados foram reprocessados pela execução runID.
+// Os que falharam novamente já foram gravados: com outro motivo, como novos rejeitados; com o mesmo motivo,
+// o próprio registro passou a apontar para runID e continua pendente.
+func markReplayed(db *sql.DB, ids []int64, runID int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var run sql.NullInt64
+	if runID != 0 {
+		run = sql.NullInt64{Int64: runID, Valid: true}
+	}
+
+	_, err := db.Exec(`
+		UPDATE raw_data.rejected_orders
+		SET replayed_at = CURRENT_TIMESTAMP, replay_run_id = $2
+		WHERE id = ANY($1) AND run_id IS DISTINCT FROM $2
+	`, pq.Array(ids), run)
+	if err != nil {
+		return fmt.Errorf("erro ao marcar rejeitados como reprocessados: %w", err)
+	}
+	return nil
+}
+
+// rejectionReplayed busca um pedido rejeitado pelo id e informa se ele já foi reprocessado.
+// Retorna sql.ErrNoRows se o id não existir.
+func rejectionReplayed(db *sql.DB, id int64) (bool, error) {
+	var replayed bool
+	err := db.QueryRow("SELECT replayed_at IS NOT NULL FROM raw_data.rejected_orders WHERE id = $1", id).Scan(&replayed)
+	return replayed, err
+}
+
+// listRejections lista os pedidos rejeitados, mais recentes primeiro
+func listRejections(db *sql.DB, runID int64, includeReplayed bool, limit int) ([]RejectedOrder, error) {
+	query := `
+		SELECT id, run_id, order_id, payload, reason, rejected_at, replayed_at, replay_run_id
+		FROM raw_data.rejected_orders
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	argIndex := 1
+
+	if runID != 0 {
+		query += fmt.Sprintf(" AND run_id = $%d", argIndex)
+		args = append(args, runID)
+		argIndex++
+	}
+	if !includeReplayed {
+		query += " AND replayed_at IS NULL"
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", argIndex)
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rejected := []RejectedOrder{} // slice vazio (e não nil) para serializar como [] no JSON
+	for rows.Next() {
+		var rej RejectedOrder
+		var run, replayRun sql.NullInt64
+		var orderID sql.NullString
+		var payload []byte
+		var rejectedAt time.Time
+		var replayedAt sql.NullTime
+
+		if err := rows.Scan(&rej.ID, &run, &orderID, &payload, &rej.Reason, &rejectedAt, &replayedAt, &replayRun); err != nil {
+			return nil, err
+		}
+
+		rej.RunID = run.Int64
+		rej.OrderID = orderID.String
+		rej.Payload = payload
+		rej.RejectedAt = rejectedAt.Format(time.RFC3339)
+		if replayedAt.Valid {
+			rej.ReplayedAt = replayedAt.Time.Format(time.RFC3339)
+		}
+		rej.ReplayRunID = replayRun.Int64
+		rejected = append(rejected, rej)
+	}
+	return rejected, rows.Err()
+}
+
+// rejectedHandler lista os pedidos rejeitados (GET /rejected?run_id=N&include_replayed=true&limit=N)
+func rejectedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var runID int64
+	if v := r.URL.Query().Get("run_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "run_id inválido", http.StatusBadRequest)
+			return
+		}
+		runID = n
+	}
+
+	includeReplayed := r.URL.Query().Get("include_replayed") == "true" // por padrão, só os pendentes
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "limit deve ser um inteiro entre 1 e 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rejected, err := listRejections(db, runID, includeReplayed, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao listar pedidos rejeitados: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RejectedOrdersResponse{Rejected: rejected})
+}
+
+// replayHandler reprocessa os pedidos rejeitados pendentes (POST /rejected/replay?id=N&async=true).
+// O reprocessamento é uma execução como outra qualquer: respeita a trava e aparece em /runs.
+func replayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Println("\n=== Reprocessamento de rejeitados disparado via HTTP ===")
+
+	opts := defaultRunOptions(triggerReplay)
+	opts.Mode = modeFull // o reprocessamento não usa watermark
+	if v := r.URL.Query().Get("id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "id inválido", http.StatusBadRequest)
+			return
+		}
+
+		// Um id inexistente ou já reprocessado não deve virar uma execução vazia reportada como sucesso
+		replayed, err := rejectionReplayed(db, n)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, fmt.Sprintf("Pedido rejeitado %d não encontrado", n), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("Erro ao buscar pedido rejeitado: %v", err), http.StatusInternalServerError)
+			return
+		case replayed:
+			http.Error(w, fmt.Sprintf("Pedido rejeitado %d já foi reprocessado", n), http.StatusConflict)
+			return
+		}
+		opts.ReplayID = n
+	}
+
+	dispatchJob(w, opts, r.URL.Query().Get("async") == "true")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retryPolicy define como repetir chamadas HTTP que falharam
+type retryPolicy struct {
+	MaxAttempts     int           // total de tentativas, incluindo a primeira
+	BaseDelay       time.Duration // espera antes da segunda tentativa; dobra a cada nova tentativa
+	MaxDelay        time.Duration // teto da espera calculada
+	Jitter          float64       // variação aleatória da espera, de 0 (nenhuma) a 1 (até ±100%)
+	RetryableStatus map[int]bool  // status HTTP que justificam nova tentativa; erros de rede sempre justificam
+	MaxRetryAfter   time.Duration // teto para o Retry-After enviado pelo servidor
+}
+
+// defaultRetryPolicy é usada pelo Data Source e pelo transformer, salvo configuração em contrário
+var defaultRetryPolicy = retryPolicy{
+	MaxAttempts:     3,
+	BaseDelay:       500 * time.Millisecond,
+	MaxDelay:        10 * time.Second,
+	Jitter:          0.2,
+	RetryableStatus: map[int]bool{408: true, 425: true, 429: true, 500: true, 502: true, 503: true, 504: true},
+	MaxRetryAfter:   2 * time.Minute,
+}
+
+var sourceRetry = defaultRetryPolicy      // PIPELINE_SOURCE_RETRY_*
+var transformerRetry = defaultRetryPolicy // PIPELINE_TRANSFORMER_RETRY_*
+
+// loadRetryPolicy aplica as variáveis <prefix>MAX_ATTEMPTS, <prefix>BASE_DELAY, <prefix>MAX_DELAY,
+// <prefix>JITTER e <prefix>STATUS_CODES sobre a política padrão
+func loadRetryPolicy(prefix string) (retryPolicy, error) {
+	p := defaultRetryPolicy
+
+	if v := os.Getenv(prefix + "MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return p, fmt.Errorf("%sMAX_ATTEMPTS inválida: %q", prefix, v)
+		}
+		p.MaxAttempts = n
+	}
+	if v := os.Getenv(prefix + "BASE_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return p, fmt.Errorf("%sBASE_DELAY inválida: %q", prefix, v)
+		}
+		p.BaseDelay = d
+	}
+	if v := os.Getenv(prefix + "MAX_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return p, fmt.Errorf("%sMAX_DELAY inválida: %q", prefix, v)
+		}
+		p.MaxDelay = d
+	}
+	if v := os.Getenv(prefix + "JITTER"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return p, fmt.Errorf("%sJITTER deve estar entre 0 e 1: %q", prefix, v)
+		}
+		p.Jitter = f
+	}
+	if v := os.Getenv(prefix + "STATUS_CODES"); v != "" {
+		p.RetryableStatus = make(map[int]bool)
+		for _, item := range strings.Split(v, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil || code < 100 || code > 599 {
+				return p, fmt.Errorf("%sSTATUS_CODES inválida: %q", prefix, item)
+			}
+			p.RetryableStatus[code] = true
+		}
+	}
+
+	return p, nil
+}
+
+// statusError é uma resposta HTTP diferente de 200, com o Retry-After enviado pelo servidor (se houver)
+type statusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status code não OK: %d", e.StatusCode)
+}
+
+// newStatusError cria o erro a partir da resposta; o corpo deve ser fechado por quem chamou
+func newStatusError(resp *http.Response) *statusError {
+	return &statusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter aceita os dois formatos do cabeçalho: segundos ("120") ou data HTTP
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// retryable indica se o erro justifica nova tentativa
+func (p retryPolicy) retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return p.RetryableStatus[se.StatusCode]
+	}
+	if errors.Is(err, errFetchTimeout) {
+		return false // o tempo total da busca acabou; nova tentativa falharia de imediato
+	}
+	return true // erro de rede ou de leitura da resposta
+}
+
+// delay calcula a espera antes da próxima tentativa: backoff exponencial com jitter,
+// ou o Retry-After do servidor quando ele pedir uma espera maior
+func (p retryPolicy) delay(attempt int, err error) time.Duration {
+	backoff := p.BaseDelay
+	for i := 1; i < attempt && backoff < p.MaxDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, p.MaxDelay)
+	if p.Jitter > 0 {
+		backoff = time.Duration(float64(backoff) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+
+	var se *statusError
+	if errors.As(err, &se) && se.RetryAfter > backoff {
+		return min(se.RetryAfter, p.MaxRetryAfter)
+	}
+	return backoff
+}
+
+// do executa fn até ela ter sucesso, o erro não ser repetível ou as tentativas acabarem.
+// Retorna o número de tentativas feitas e o erro da última.
+func (p retryPolicy) do(name string, fn func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return attempt, nil
+		}
+		if attempt >= p.MaxAttempts || !p.retryable(err) {
+			return attempt, err
+		}
+
+		wait := p.delay(attempt, err)
+		log.Printf("🔁 %s falhou na tentativa %d de %d (%v), nova tentativa em %s", name, attempt, p.MaxAttempts, err, wait.Round(time.Millisecond))
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 5 ", 5 * time.Second},
+		{"-3", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0}, // data no passado
+		{"amanhã", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, esperado %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := retryPolicy{
+		BaseDelay:     100 * time.Millisecond,
+		MaxDelay:      time.Second,
+		MaxRetryAfter: 10 * time.Second,
+	}
+	network := errors.New("conexão recusada")
+
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		want    time.Duration
+	}{
+		{"primeira espera", 1, network, 100 * time.Millisecond},
+		{"dobra a cada tentativa", 3, network, 400 * time.Millisecond},
+		{"teto", 10, network, time.Second},
+		{"Retry-After maior que o backoff", 1, &statusError{StatusCode: 503, RetryAfter: 5 * time.Second}, 5 * time.Second},
+		{"Retry-After menor que o backoff", 3, &statusError{StatusCode: 503, RetryAfter: 200 * time.Millisecond}, 400 * time.Millisecond},
+		{"Retry-After acima do teto", 1, &statusError{StatusCode: 429, RetryAfter: time.Hour}, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := p.delay(tt.attempt, tt.err); got != tt.want {
+			t.Errorf("%s: delay = %s, esperado %s", tt.name, got, tt.want)
+		}
+	}
+
+	// Com jitter, a espera varia no máximo a fração configurada
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.delay(1, network); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("delay com jitter = %s, fora de [50ms, 150ms]", got)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	p := defaultRetryPolicy
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"erro de rede", errors.New("conexão recusada"), true},
+		{"503", &statusError{StatusCode: 503}, true},
+		{"429 encapsulado", fmt.Errorf("página 2: %w", &statusError{StatusCode: 429}), true},
+		{"404", &statusError{StatusCode: 404}, false},
+		{"400", &statusError{StatusCode: 400}, false},
+		{"tempo total da busca esgotado", fmt.Errorf("página 3: %w", errFetchTimeout), false},
+	}
+
+	for _, tt := range tests {
+		if got := p.retryable(tt.err); got != tt.want {
+			t.Errorf("%s: retryable = %t, esperado %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDo(t *testing.T) {
+	p := retryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, RetryableStatus: map[int]bool{503: true}}
+
+	t.Run("sucesso após falhas", func(t *testing.T) {
+		calls := 0
+		attempts, err := p.do("teste", func() error {
+			calls++
+			if calls < 3 {
+				return &statusError{StatusCode: 503}
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Errorf("do = (%d, %v), esperado (3, nil)", attempts, err)
+		}
+	})
+
+	t.Run("tentativas esgotadas", func(t *testing.T) {
+		attempts, err := p.do("teste", func() error { return &statusError{StatusCode: 503} })
+		if err == nil || attempts != 3 {
+			t.Errorf("do = (%d, %v), esperado 3 tentativas e erro", attempts, err)
+		}
+	})
+
+	t.Run("erro não repetível", func(t *testing.T) {
+		attempts, err := p.do("teste", func() error { return &statusError{StatusCode: 404} })
+		var se *statusError
+		if !errors.As(err, &se) || se.StatusCode != 404 || attempts != 1 {
+			t.Errorf("do = (%d, %v), esperado 1 tentativa e o erro 404", attempts, err)
+		}
+	})
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status possíveis de uma execução registrada em pipeline.runs
+const (
+	runStatusRunning   = "running"
+	runStatusSucceeded = "succeeded"
+	runStatusFailed    = "failed"
+)
+
+// Status possíveis da chamada ao transformer dentro de uma execução
+const (
+	transformerNotCalled = "not_called" // nenhum pedido novo, transformer não foi chamado
+	transformerSucceeded = "succeeded"
+	transformerFailed    = "failed"
+	transformerPending   = "aggregation_pending" // circuito aberto: chamada pulada, refeita quando o circuito semiabrir
+)
+
+// Origem de uma execução
+const (
+	triggerManual   = "manual"   // disparada via POST /trigger
+	triggerSchedule = "schedule" // disparada pelo agendador (PIPELINE_SCHEDULE)
+	triggerReplay   = "replay"   // reprocessamento de pedidos rejeitados (POST /rejected/replay)
+	triggerUpload   = "upload"   // arquivo enviado em POST /ingest/csv
+)
+
+// RunOptions define como uma execução deve ser feita
+type RunOptions struct {
+	Trigger string // manual, schedule, replay ou upload
+	Mode    string // incremental ou full
+	Strict  bool   // true: tudo ou nada em uma única transação
+	Upsert  bool   // true: atualiza status, value e payment_method de pedidos já existentes
+
+	ReplayID int64   // no reprocessamento, id de um único rejeitado (0 = todos os pendentes)
+	Upload   []Order // pedidos de um arquivo enviado, usados no lugar da fonte configurada
+}
+
+// defaultRunOptions retorna as opções padrão de uma execução, configuradas por variáveis de ambiente
+func defaultRunOptions(trigger string) RunOptions {
+	return RunOptions{
+		Trigger: trigger,
+		Mode:    modeIncremental,
+		Strict:  strictDefault,
+		Upsert:  upsertDefault,
+	}
+}
+
+// RunResult acumula as contagens de uma execução do pipeline
+type RunResult struct {
+	Fetched             int            `json:"fetched"`              // pedidos recebidos da fonte
+	Pages               int            `json:"pages"`                // páginas (ou arquivos) lidas da fonte, atualizado durante a busca
+	Inserted            int            `json:"inserted"`             // pedidos novos gravados em raw_data.orders
+	Updated             int            `json:"updated"`              // pedidos existentes alterados (modo upsert)
+	Skipped             int            `json:"skipped"`              // pedidos que já existiam no banco (ON CONFLICT)
+	Failed              int            `json:"failed"`               // pedidos reprovados na validação ou com erro de inserção
+	Rejections          map[string]int `json:"rejections,omitempty"` // pedidos reprovados na validação, por regra
+	Since               string         `json:"since,omitempty"`      // watermark usado na busca incremental (vazio em carga completa)
+	TransformerStatus   string         `json:"transformer_status"`
+	TransformerError    string         `json:"transformer_error,omitempty"`
+	SourceAttempts      int            `json:"source_attempts"`      // requisições ao Data Source, incluindo novas tentativas
+	TransformerAttempts int            `json:"transformer_attempts"` // chamadas ao transformer, incluindo novas tentativas
+}
+
+// PipelineRun representa uma execução do pipeline registrada em pipeline.runs
+type PipelineRun struct {
+	ID         int64   `json:"id"`
+	Status     string  `json:"status"`
+	Trigger    string  `json:"trigger"`
+	Mode       string  `json:"mode"`
+	Strict     bool    `json:"strict"`
+	Upsert     bool    `json:"upsert"`
+	StartedAt  string  `json:"started_at"`
+	FinishedAt *string `json:"finished_at,omitempty"` // nil enquanto a execução está em andamento
+	RunResult
+	Error string `json:"error,omitempty"`
+}
+
+// RunsResponse representa a resposta do endpoint GET /runs
+type RunsResponse struct {
+	Runs []PipelineRun `json:"runs"`
+}
+
+// setupRunsTable cria o schema pipeline e a tabela de histórico de execuções se não existirem
+func setupRunsTable(db *sql.DB) error {
+	_, err := db.Exec("CREATE SCHEMA IF NOT EXISTS pipeline") // schema próprio do pipeline, separado dos dados brutos e agregados
+	if err != nil {
+		return fmt.Errorf("erro ao criar schema pipeline: %w", err)
+	}
+
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS pipeline.runs (
+			id BIGSERIAL PRIMARY KEY,
+			status VARCHAR(20) NOT NULL,
+			started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			finished_at TIMESTAMPTZ,
+			fetched INTEGER NOT NULL DEFAULT 0,
+			inserted INTEGER NOT NULL DEFAULT 0,
+			skipped INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0,
+			transformer_status VARCHAR(20) NOT NULL DEFAULT 'not_called',
+			transformer_error TEXT,
+			error TEXT
+		)
+	`
+
+	_, err = db.Exec(createTableSQL)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela pipeline.runs: %w", err)
+	}
+
+	// Colunas adicionadas após a criação da tabela; ADD COLUMN IF NOT EXISTS mantém bancos existentes atualizados
+	migrations := []string{
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS trigger VARCHAR(20) NOT NULL DEFAULT 'manual'",
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS mode VARCHAR(20) NOT NULL DEFAULT 'full'",
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS since TIMESTAMPTZ",
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS strict BOOLEAN NOT NULL DEFAULT false",
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS upsert BOOLEAN NOT NULL DEFAULT false",
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS updated INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS rejections JSONB",
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS pages INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS source_attempts INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE pipeline.runs ADD COLUMN IF NOT EXISTS transformer_attempts INTEGER NOT NULL DEFAULT 0",
+	}
+	for _, migration := range migrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("erro ao atualizar tabela pipeline.runs: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// startRun registra o início de uma execução e retorna o id gerado
+func startRun(db *sql.DB, opts RunOptions) (int64, error) {
+	var id int64
+	err := db.QueryRow(
+		"INSERT INTO pipeline.runs (status, trigger, mode, strict, upsert) VALUES ($1, $2, $3, $4, $5) RETURNING id", // RETURNING devolve o id gerado pelo BIGSERIAL
+		runStatusRunning,
+		opts.Trigger,
+		opts.Mode,
+		opts.Strict,
+		opts.Upsert,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao registrar execução: %w", err)
+	}
+	return id, nil
+}
+
+// finishRun grava o resultado final de uma execução
+func finishRun(db *sql.DB, id int64, result RunResult, runErr error) error {
+	status := runStatusSucceeded
+	var errText sql.NullString // NULL quando a execução não teve erro
+	if runErr != nil {
+		status = runStatusFailed
+		errText = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+
+	var transformerErr sql.NullString
+	if result.TransformerError != "" {
+		transformerErr = sql.NullString{String: result.TransformerError, Valid: true}
+	}
+
+	transformerStatus := result.TransformerStatus
+	if transformerStatus == "" {
+		transformerStatus = transformerNotCalled
+	}
+
+	var since sql.NullString // NULL em carga completa
+	if result.Since != "" {
+		since = sql.NullString{String: result.Since, Valid: true}
+	}
+
+	var rejections sql.NullString // NULL quando nenhum pedido foi reprovado na validação
+	if len(result.Rejections) > 0 {
+		b, err := json.Marshal(result.Rejections)
+		if err != nil {
+			return fmt.Errorf("erro ao serializar rejeições da execução %d: %w", id, err)
+		}
+		rejections = sql.NullString{String: string(b), Valid: true}
+	}
+
+	_, err := db.Exec(`
+		UPDATE pipeline.runs SET
+			status = $2,
+			finished_at = CURRENT_TIMESTAMP,
+			fetched = $3,
+			inserted = $4,
+			skipped = $5,
+			failed = $6,
+			transformer_status = $7,
+			transformer_error = $8,
+			error = $9,
+			since = $10,
+			updated = $11,
+			rejections = $12,
+			pages = $13,
+			source_attempts = $14,
+			transformer_attempts = $15
+		WHERE id = $1
+	`, id, status, result.Fetched, result.Inserted, result.Skipped, result.Failed, transformerStatus, transformerErr, errText, since, result.Updated, rejections, result.Pages,
+		result.SourceAttempts, result.TransformerAttempts)
+	if err != nil {
+		return fmt.Errorf("erro ao finalizar execução %d: %w", id, err)
+	}
+	return nil
+}
+
+// failInterruptedRuns marca como falhas as execuções que ficaram em running porque o processo morreu
+// no meio (reinício do container, OOM). Só deve ser chamada com o advisory lock adquirido: com ele,
+// nenhuma outra réplica pode estar executando, então todo registro em running é órfão.
+func failInterruptedRuns(db *sql.DB) (int64, error) {
+	res, err := db.Exec(`
+		UPDATE pipeline.runs
+		SET status = $1, finished_at = CURRENT_TIMESTAMP, error = 'interrompida'
+		WHERE status = $2
+	`, runStatusFailed, runStatusRunning)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao marcar execuções interrompidas: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// updateRunProgress grava o andamento da busca enquanto a execução está em andamento
+func updateRunProgress(db *sql.DB, id int64, pages, fetched int) error {
+	_, err := db.Exec("UPDATE pipeline.runs SET pages = $2, fetched = $3 WHERE id = $1", id, pages, fetched)
+	if err != nil {
+		return fmt.Errorf("erro ao atualizar progresso da execução %d: %w", id, err)
+	}
+	return nil
+}
+
+// executeRun executa o pipeline registrando início e fim em pipeline.runs.
+// onStart, se informado, recebe o id da execução assim que ela é registrada.
+// Falhas ao gravar o histórico são apenas logadas para não impedir a ingestão.
+func executeRun(opts RunOptions, onStart func(runID int64)) (int64, RunResult, error) {
+	runID, err := startRun(db, opts)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+	} else if onStart != nil {
+		onStart(runID)
+	}
+
+	result, runErr := runPipeline(runID, opts)
+
+	if runID != 0 {
+		if err := finishRun(db, runID, result, runErr); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}
+
+	return runID, result, runErr
+}
+
+const runColumns = `
+	id, status, trigger, mode, strict, upsert, started_at, finished_at, fetched, inserted, updated, skipped, failed,
+	transformer_status, transformer_error, error, since, rejections, pages, source_attempts, transformer_attempts
+`
+
+// scanRun lê uma linha de pipeline.runs para a estrutura PipelineRun
+func scanRun(scanner interface{ Scan(...interface{}) error }) (PipelineRun, error) {
+	var run PipelineRun
+	var startedAt time.Time
+	var finishedAt sql.NullTime
+	var transformerErr, errText sql.NullString
+	var since sql.NullTime
+	var rejections []byte
+
+	err := scanner.Scan(
+		&run.ID,
+		&run.Status,
+		&run.Trigger,
+		&run.Mode,
+		&run.Strict,
+		&run.Upsert,
+		&startedAt,
+		&finishedAt,
+		&run.Fetched,
+		&run.Inserted,
+		&run.Updated,
+		&run.Skipped,
+		&run.Failed,
+		&run.TransformerStatus,
+		&transformerErr,
+		&errText,
+		&since,
+		&rejections,
+		&run.Pages,
+		&run.SourceAttempts,
+		&run.TransformerAttempts,
+	)
+	if err != nil {
+		return run, err
+	}
+
+	run.StartedAt = startedAt.Format(time.RFC3339)
+	if finishedAt.Valid {
+		finished := finishedAt.Time.Format(time.RFC3339)
+		run.FinishedAt = &finished
+	}
+	run.TransformerError = transformerErr.String
+	run.Error = errText.String
+	if since.Valid {
+		run.Since = since.Time.Format(time.RFC3339)
+	}
+	if rejections != nil {
+		if err := json.Unmarshal(rejections, &run.Rejections); err != nil {
+			return run, fmt.Errorf("erro ao ler rejeições da execução %d: %w", run.ID, err)
+		}
+	}
+	return run, nil
+}
+
+// listRuns retorna as execuções mais recentes primeiro
+func listRuns(db *sql.DB, limit int) ([]PipelineRun, error) {
+	rows, err := db.Query("SELECT "+runColumns+" FROM pipeline.runs ORDER BY id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []PipelineRun{} // slice vazio (e não nil) para serializar como [] no JSON
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// getRun busca uma execução pelo id; retorna sql.ErrNoRows se não existir
+func getRun(db *sql.DB, id int64) (PipelineRun, error) {
+	return scanRun(db.QueryRow("SELECT "+runColumns+" FROM pipeline.runs WHERE id = $1", id))
+}
+
+// runsHandler lista as execuções do pipeline (GET /runs?limit=N)
+func runsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 20 // padrão: últimas 20 execuções
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 100 {
+			http.Error(w, "limit deve ser um inteiro entre 1 e 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	runs, err := listRuns(db, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao listar execuções: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RunsResponse{Runs: runs})
+}
+
+// runHandler retorna uma execução específica (GET /runs/{id})
+func runHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/runs/"), 10, 64) // extrai o {id} do caminho
+	if err != nil {
+		http.Error(w, "id de execução inválido", http.StatusBadRequest)
+		return
+	}
+
+	run, err := getRun(db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Execução não encontrada", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Erro ao buscar execução: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cronSchedule representa uma expressão cron de 5 campos: minuto hora dia-do-mês mês dia-da-semana
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool // true quando o campo é "*", usado na regra de dia do mês OU dia da semana
+}
+
+// cronField descreve os limites de cada campo da expressão
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minuto", 0, 59},
+	{"hora", 0, 23},
+	{"dia do mês", 1, 31},
+	{"mês", 1, 12},
+	{"dia da semana", 0, 6}, // 0 = domingo
+}
+
+// parseCron interpreta expressões como "*/15 * * * *", "0 3 * * 1-5" ou "0,30 8-18 * * *"
+func parseCron(expr string) (*cronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("expressão cron deve ter 5 campos, recebido %d: %q", len(parts), expr)
+	}
+
+	sets := make([]map[int]bool, len(parts))
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	// Aceitar 7 como domingo, como na maioria das implementações de cron
+	if sets[4][7] {
+		sets[4][0] = true
+		delete(sets[4], 7)
+	}
+
+	return &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseCronField interpreta um campo com listas (a,b), intervalos (a-b) e passos (*/n, a-b/n)
+func parseCronField(field string, spec cronField) (map[int]bool, error) {
+	set := make(map[int]bool)
+	max := spec.max
+	if spec.name == "dia da semana" {
+		max = 7 // permite 7 como domingo
+	}
+
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("passo inválido no campo %s: %q", spec.name, item)
+			}
+			rangePart, step = item[:i], n
+		}
+
+		lo, hi := spec.min, spec.max
+		switch {
+		case rangePart == "*":
+			// mantém o intervalo completo do campo
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			a, errA := strconv.Atoi(bounds[0])
+			b, errB := strconv.Atoi(bounds[1])
+			if errA != nil || errB != nil || a > b {
+				return nil, fmt.Errorf("intervalo inválido no campo %s: %q", spec.name, item)
+			}
+			lo, hi = a, b
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return nil, fmt.Errorf("valor inválido no campo %s: %q", spec.name, item)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = spec.max // "5/10" significa de 5 até o fim do campo, de 10 em 10
+			}
+		}
+
+		if lo < spec.min || hi > max {
+			return nil, fmt.Errorf("valor fora do intervalo %d-%d no campo %s: %q", spec.min, spec.max, spec.name, item)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+
+	return set, nil
+}
+
+// matchesDay aplica a regra do cron: se dia do mês e dia da semana forem restritos, basta um deles coincidir
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	domMatch := c.dom[t.Day()]
+	dowMatch := c.dow[int(t.Weekday())]
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// next retorna o primeiro instante estritamente depois de t que satisfaz a expressão
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0) // expressões impossíveis (ex.: 30 de fevereiro) não podem travar o loop
+
+	for t.Before(limit) {
+		if !c.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()) // pula para o início do próximo mês
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()) // pula para o próximo dia
+			continue
+		}
+		if !c.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()) // pula para a próxima hora
+			continue
+		}
+		if !c.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// SchedulerStatus representa o estado do agendador exposto em /health
+type SchedulerStatus struct {
+	Schedule   string `json:"schedule"`
+	NextRun    string `json:"next_run,omitempty"`
+	LastRun    string `json:"last_run,omitempty"`
+	LastJobID  string `json:"last_job_id,omitempty"`
+	LastStatus string `json:"last_status,omitempty"` // status do último job agendado, ou "skipped" se já havia execução em andamento
+}
+
+// scheduler dispara o pipeline periodicamente de acordo com PIPELINE_SCHEDULE
+type scheduler struct {
+	expr     string
+	schedule *cronSchedule
+
+	mu     sync.Mutex
+	status SchedulerStatus
+}
+
+var pipelineScheduler *scheduler // nil quando PIPELINE_SCHEDULE não está configurada
+
+// newScheduler valida a expressão cron e cria o agendador.
+// Expressões válidas que nunca disparam (ex.: "0 0 31 2 *") também são recusadas.
+func newScheduler(expr string) (*scheduler, error) {
+	schedule, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("expressão cron nunca dispara: %q", expr)
+	}
+	return &scheduler{
+		expr:     expr,
+		schedule: schedule,
+		status:   SchedulerStatus{Schedule: expr},
+	}, nil
+}
+
+// Status retorna uma cópia do estado atual do agendador
+func (s *scheduler) Status() SchedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// run executa o loop do agendador; deve ser chamado em uma goroutine
+func (s *scheduler) run() {
+	for {
+		next := s.schedule.next(time.Now())
+		if next.IsZero() {
+			log.Printf("⚠️  Agendamento %q nunca dispara, agendador encerrado", s.expr)
+			return
+		}
+
+		s.mu.Lock()
+		s.status.NextRun = next.Format(time.RFC3339)
+		s.mu.Unlock()
+
+		time.Sleep(time.Until(next))
+		s.fire()
+	}
+}
+
+// fire dispara uma execução agendada, respeitando a mesma trava das execuções manuais
+func (s *scheduler) fire() {
+	fmt.Println("\n=== Pipeline disparado pelo agendador ===")
+
+	s.mu.Lock()
+	s.status.LastRun = time.Now().Format(time.RFC3339)
+	s.status.LastJobID = ""
+	s.mu.Unlock()
+
+	job, err := jobs.start(defaultRunOptions(triggerSchedule))
+	if err != nil {
+		status := jobStatusFailed
+		if errors.Is(err, errPipelineBusy) {
+			status = "skipped"
+			log.Printf("⏭️  Execução agendada ignorada: %v", err)
+		} else {
+			log.Printf("❌ Erro ao iniciar execução agendada: %v", err)
+		}
+
+		s.mu.Lock()
+		s.status.LastStatus = status
+		s.mu.Unlock()
+		return
+	}
+
+	s.mu.Lock()
+	s.status.LastJobID = job.ID
+	s.status.LastStatus = jobStatusRunning
+	s.mu.Unlock()
+
+	finished := jobs.run(job)
+
+	s.mu.Lock()
+	s.status.LastStatus = finished.Status
+	s.mu.Unlock()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"*/15 * * * *", false},
+		{"0 3 * * 1-5", false},
+		{"0,30 8-18 * * *", false},
+		{"5/10 * * * *", false},
+		{"0 0 * * 7", false}, // 7 = domingo
+		{"* * * *", true},    // campos faltando
+		{"60 * * * *", true}, // minuto fora do intervalo
+		{"0 24 * * *", true},
+		{"0 0 0 * *", true}, // dia do mês começa em 1
+		{"0 0 * 13 *", true},
+		{"0 0 * * 8", true},
+		{"*/0 * * * *", true}, // passo zero
+		{"5-1 * * * *", true}, // intervalo invertido
+		{"a * * * *", true},
+	}
+
+	for _, tt := range tests {
+		_, err := parseCron(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCron(%q) erro = %v, esperado erro: %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string // vazio = nunca dispara
+	}{
+		{"passo de minutos", "*/15 * * * *", "2026-01-20 10:07", "2026-01-20 10:15"},
+		{"estritamente depois", "*/15 * * * *", "2026-01-20 10:15", "2026-01-20 10:30"},
+		{"passo a partir de valor", "5/20 * * * *", "2026-01-20 10:30", "2026-01-20 10:45"},
+		{"lista", "0,30 * * * *", "2026-01-20 10:10", "2026-01-20 10:30"},
+		{"intervalo de horas", "0 8-18 * * *", "2026-01-20 18:30", "2026-01-21 08:00"},
+		{"dias úteis pula o fim de semana", "0 3 * * 1-5", "2026-01-23 04:00", "2026-01-26 03:00"}, // sexta -> segunda
+		{"domingo como 7", "0 0 * * 7", "2026-01-20 00:00", "2026-01-25 00:00"},
+		{"virada de mês", "0 0 1 * *", "2026-01-20 00:00", "2026-02-01 00:00"},
+		{"virada de ano", "0 0 1 1 *", "2026-01-20 00:00", "2027-01-01 00:00"},
+		{"dia do mês OU dia da semana", "0 0 15 * 1", "2026-01-20 00:00", "2026-01-26 00:00"},      // segunda antes do dia 15
+		{"dia do mês OU dia da semana (dia)", "0 0 1 * 5", "2026-01-30 12:00", "2026-02-01 00:00"}, // dia 1 antes da sexta
+		{"dia da semana com dia do mês *", "0 0 * * 3", "2026-01-20 00:00", "2026-01-21 00:00"},
+		{"29 de fevereiro", "0 0 29 2 *", "2026-01-20 00:00", "2028-02-29 00:00"},
+		{"31 pula meses curtos", "0 0 31 * *", "2026-04-01 00:00", "2026-05-31 00:00"},
+		{"data impossível", "0 0 31 2 *", "2026-01-20 00:00", ""},
+		{"data impossível (30/02)", "0 0 30 2 *", "2026-01-20 00:00", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron(%q): %v", tt.expr, err)
+			}
+			got := c.next(at(tt.from))
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("next(%s) = %s, esperado nunca disparar", tt.from, got)
+				}
+				return
+			}
+			if want := at(tt.want); !got.Equal(want) {
+				t.Errorf("next(%s) = %s, esperado %s", tt.from, got, want)
+			}
+		})
+	}
+}
+
+func TestNewSchedulerRejectsImpossibleExpression(t *testing.T) {
+	if _, err := newScheduler("0 0 31 2 *"); err == nil {
+		t.Error("newScheduler aceitou uma expressão que nunca dispara")
+	}
+	if _, err := newScheduler("*/15 * * * *"); err != nil {
+		t.Errorf("newScheduler recusou expressão válida: %v", err)
+	}
+}
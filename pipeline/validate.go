@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Regras de validação; os nomes são as chaves das contagens em RunResult.Rejections
+const (
+	ruleCreatedAt     = "created_at"     // created_at ausente ou fora do formato RFC 3339
+	ruleFutureDate    = "future_date"    // created_at no futuro (além da tolerância de relógio)
+	ruleStatus        = "status"         // status fora da lista permitida
+	rulePaymentMethod = "payment_method" // método de pagamento fora da lista permitida
+	ruleValueRange    = "value_range"    // valor fora do intervalo permitido
+	ruleOrderID       = "order_id"       // order_id fora do formato esperado
+)
+
+// validationRules define o que é um pedido válido antes da gravação
+type validationRules struct {
+	Statuses       map[string]bool // nil aceita qualquer status
+	PaymentMethods map[string]bool // nil aceita qualquer método de pagamento
+	MinValue       float64
+	MaxValue       float64
+	OrderIDPattern *regexp.Regexp // nil aceita qualquer order_id não vazio
+	ClockSkew      time.Duration  // tolerância para created_at à frente do relógio do pipeline
+}
+
+// Padrões alinhados com os valores que o backend2-api entende e com as colunas de raw_data.orders
+var orderRules = validationRules{
+	Statuses:       stringSet("approved,pending,cancelled"),
+	PaymentMethods: stringSet("credit_card,pix,boleto"),
+	MinValue:       0,
+	MaxValue:       99999999.99, // maior valor aceito por NUMERIC(10, 2)
+	OrderIDPattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,254}$`),
+	ClockSkew:      5 * time.Minute,
+}
+
+// loadValidationRules aplica as variáveis de ambiente PIPELINE_ALLOWED_STATUSES, PIPELINE_ALLOWED_PAYMENT_METHODS,
+// PIPELINE_MIN_VALUE, PIPELINE_MAX_VALUE, PIPELINE_ORDER_ID_PATTERN e PIPELINE_MAX_CLOCK_SKEW sobre os padrões.
+// Nas listas, "*" desativa a regra.
+func loadValidationRules() (validationRules, error) {
+	r := orderRules
+
+	if v := os.Getenv("PIPELINE_ALLOWED_STATUSES"); v != "" {
+		r.Statuses = stringSet(v)
+	}
+	if v := os.Getenv("PIPELINE_ALLOWED_PAYMENT_METHODS"); v != "" {
+		r.PaymentMethods = stringSet(v)
+	}
+	if v := os.Getenv("PIPELINE_MIN_VALUE"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return r, fmt.Errorf("PIPELINE_MIN_VALUE inválida: %q", v)
+		}
+		r.MinValue = n
+	}
+	if v := os.Getenv("PIPELINE_MAX_VALUE"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return r, fmt.Errorf("PIPELINE_MAX_VALUE inválida: %q", v)
+		}
+		r.MaxValue = n
+	}
+	if r.MinValue > r.MaxValue {
+		return r, fmt.Errorf("PIPELINE_MIN_VALUE (%g) maior que PIPELINE_MAX_VALUE (%g)", r.MinValue, r.MaxValue)
+	}
+	if v, ok := os.LookupEnv("PIPELINE_ORDER_ID_PATTERN"); ok {
+		r.OrderIDPattern = nil // vazio desativa a regra
+		if v != "" {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return r, fmt.Errorf("PIPELINE_ORDER_ID_PATTERN inválida: %w", err)
+			}
+			r.OrderIDPattern = re
+		}
+	}
+	if v := os.Getenv("PIPELINE_MAX_CLOCK_SKEW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return r, fmt.Errorf("PIPELINE_MAX_CLOCK_SKEW inválida: %q", v)
+		}
+		r.ClockSkew = d
+	}
+
+	return r, nil
+}
+
+// stringSet converte uma lista separada por vírgulas em conjunto; "*" retorna nil (aceita tudo)
+func stringSet(list string) map[string]bool {
+	if strings.TrimSpace(list) == "*" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			set[item] = true
+		}
+	}
+	return set
+}
+
+// check valida um pedido e retorna o created_at já convertido.
+// Em caso de falha, retorna a regra violada e o motivo legível.
+func (r validationRules) check(order Order, now time.Time) (time.Time, string, string) {
+	if order.OrderID == "" {
+		return time.Time{}, ruleOrderID, "order_id vazio"
+	}
+	if r.OrderIDPattern != nil && !r.OrderIDPattern.MatchString(order.OrderID) {
+		return time.Time{}, ruleOrderID, fmt.Sprintf("order_id %q fora do formato %s", order.OrderID, r.OrderIDPattern)
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, order.CreatedAt) // converte a string para time.Time
+	if err != nil {
+		return time.Time{}, ruleCreatedAt, fmt.Sprintf("created_at inválido: %v", err)
+	}
+	if createdAt.After(now.Add(r.ClockSkew)) {
+		return time.Time{}, ruleFutureDate, fmt.Sprintf("created_at %s está no futuro", order.CreatedAt)
+	}
+
+	if r.Statuses != nil && !r.Statuses[order.Status] {
+		return time.Time{}, ruleStatus, fmt.Sprintf("status %q não permitido", order.Status)
+	}
+	if r.PaymentMethods != nil && !r.PaymentMethods[order.PaymentMethod] {
+		return time.Time{}, rulePaymentMethod, fmt.Sprintf("payment_method %q não permitido", order.PaymentMethod)
+	}
+	if order.Value < r.MinValue || order.Value > r.MaxValue {
+		return time.Time{}, ruleValueRange, fmt.Sprintf("value %.2f fora do intervalo [%.2f, %.2f]", order.Value, r.MinValue, r.MaxValue)
+	}
+
+	return createdAt, "", ""
+}
+
+// validateOrders normaliza (se houver mapeamento) e separa os pedidos válidos dos inválidos antes da gravação.
+// Os inválidos voltam em insertStats.Rejected, como recebidos da fonte; a contagem por regra vai para o resultado da execução.
+func validateOrders(orders []Order, m *valueMapping, r validationRules, now time.Time) ([]parsedOrder, insertStats, map[string]int) {
+	var stats insertStats
+	counts := make(map[string]int)
+
+	valid := make([]parsedOrder, 0, len(orders))
+	for _, raw := range orders {
+		order, rule, reason := raw, "", ""
+		if m != nil {
+			order, rule, reason = m.normalize(raw)
+		}
+
+		var createdAt time.Time
+		if rule == "" {
+			createdAt, rule, reason = r.check(order, now)
+		}
+		if rule != "" {
+			log.Printf("⚠️  Pedido %s rejeitado na validação: %s", raw.OrderID, reason)
+			stats.reject(raw, reason) // guarda o pedido original para que o reprocessamento passe pelo mapeamento de novo
+			counts[rule]++
+			continue
+		}
+		valid = append(valid, parsedOrder{Order: order, CreatedAtTime: createdAt})
+	}
+
+	return valid, stats, counts
+}
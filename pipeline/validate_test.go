@@ -0,0 +1,118 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestValidationCheck(t *testing.T) {
+	now := time.Date(2026, 1, 20, 12, 0, 0, 0, time.UTC)
+	rules := validationRules{
+		Statuses:       stringSet("approved,pending,cancelled"),
+		PaymentMethods: stringSet("credit_card,pix,boleto"),
+		MinValue:       0,
+		MaxValue:       1000,
+		OrderIDPattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`),
+		ClockSkew:      5 * time.Minute,
+	}
+	valid := Order{OrderID: "ORD-1", CreatedAt: "2026-01-20T10:00:00Z", Status: "approved", Value: 199.90, PaymentMethod: "pix"}
+
+	tests := []struct {
+		name   string
+		change func(*Order)
+		rules  func(*validationRules)
+		want   string // regra violada; vazio = válido
+	}{
+		{"válido", nil, nil, ""},
+		{"order_id vazio", func(o *Order) { o.OrderID = "" }, nil, ruleOrderID},
+		{"order_id fora do formato", func(o *Order) { o.OrderID = "-ORD" }, nil, ruleOrderID},
+		{"sem padrão de order_id", func(o *Order) { o.OrderID = "-ORD" }, func(r *validationRules) { r.OrderIDPattern = nil }, ""},
+		{"created_at sem fuso", func(o *Order) { o.CreatedAt = "2026-01-20T10:00:00" }, nil, ruleCreatedAt},
+		{"created_at vazio", func(o *Order) { o.CreatedAt = "" }, nil, ruleCreatedAt},
+		{"dentro da tolerância de relógio", func(o *Order) { o.CreatedAt = "2026-01-20T12:04:00Z" }, nil, ""},
+		{"no futuro", func(o *Order) { o.CreatedAt = "2026-01-20T12:06:00Z" }, nil, ruleFutureDate},
+		{"status não permitido", func(o *Order) { o.Status = "refunded" }, nil, ruleStatus},
+		{"qualquer status", func(o *Order) { o.Status = "refunded" }, func(r *validationRules) { r.Statuses = stringSet("*") }, ""},
+		{"payment_method não permitido", func(o *Order) { o.PaymentMethod = "cash" }, nil, rulePaymentMethod},
+		{"valor negativo", func(o *Order) { o.Value = -1 }, nil, ruleValueRange},
+		{"valor no limite", func(o *Order) { o.Value = 1000 }, nil, ""},
+		{"valor acima do máximo", func(o *Order) { o.Value = 1000.01 }, nil, ruleValueRange},
+	}
+
+	for _, tt := range tests {
+		order, r := valid, rules
+		if tt.change != nil {
+			tt.change(&order)
+		}
+		if tt.rules != nil {
+			tt.rules(&r)
+		}
+
+		createdAt, rule, reason := r.check(order, now)
+		if rule != tt.want {
+			t.Errorf("%s: regra = %q (%s), esperado %q", tt.name, rule, reason, tt.want)
+			continue
+		}
+		if rule == "" && createdAt.IsZero() {
+			t.Errorf("%s: created_at não foi convertido", tt.name)
+		}
+		if rule != "" && reason == "" {
+			t.Errorf("%s: rejeitado sem motivo", tt.name)
+		}
+	}
+}
+
+func TestStringSet(t *testing.T) {
+	if set := stringSet(" * "); set != nil {
+		t.Errorf(`stringSet("*") = %v, esperado nil`, set)
+	}
+	set := stringSet(" approved, pending ,,cancelled")
+	if len(set) != 3 || !set["approved"] || !set["pending"] || !set["cancelled"] {
+		t.Errorf("stringSet = %v, esperado approved, pending e cancelled", set)
+	}
+}
+
+func TestValidateOrders(t *testing.T) {
+	now := time.Date(2026, 1, 20, 12, 0, 0, 0, time.UTC)
+	mapping := &valueMapping{
+		Status:         normalizeKeys(map[string]string{"PAID": "approved"}),
+		PaymentMethod:  normalizeKeys(map[string]string{"cartao": "credit_card"}),
+		RejectUnmapped: true,
+	}
+	orders := []Order{
+		{OrderID: "ORD-1", CreatedAt: "2026-01-20T10:00:00Z", Status: "paid", Value: 10, PaymentMethod: "Cartao"},
+		{OrderID: "ORD-2", CreatedAt: "2026-01-20T10:00:00Z", Status: "refunded", Value: 10, PaymentMethod: "cartao"},
+		{OrderID: "ORD-3", CreatedAt: "ontem", Status: "approved", Value: 10, PaymentMethod: "credit_card"},
+		{OrderID: "ORD-4", CreatedAt: "2026-01-20T10:00:00Z", Status: "approved", Value: -5, PaymentMethod: "credit_card"},
+	}
+
+	valid, stats, counts := validateOrders(orders, mapping, orderRules, now)
+
+	if len(valid) != 1 || valid[0].OrderID != "ORD-1" {
+		t.Fatalf("válidos = %+v, esperado apenas ORD-1", valid)
+	}
+	if valid[0].Status != "approved" || valid[0].PaymentMethod != "credit_card" {
+		t.Errorf("ORD-1 não foi normalizado: %+v", valid[0].Order)
+	}
+	if !valid[0].CreatedAtTime.Equal(time.Date(2026, 1, 20, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("created_at convertido = %s", valid[0].CreatedAtTime)
+	}
+
+	wantCounts := map[string]int{ruleUnmappedStatus: 1, ruleCreatedAt: 1, ruleValueRange: 1}
+	if len(counts) != len(wantCounts) {
+		t.Errorf("contagens = %v, esperado %v", counts, wantCounts)
+	}
+	for rule, n := range wantCounts {
+		if counts[rule] != n {
+			t.Errorf("contagem de %s = %d, esperado %d", rule, counts[rule], n)
+		}
+	}
+
+	if stats.Failed != 3 || len(stats.Rejected) != 3 {
+		t.Fatalf("rejeitados = %d (%d registros), esperado 3", stats.Failed, len(stats.Rejected))
+	}
+	if got := stats.Rejected[0].Order; got != orders[1] { // o pedido rejeitado é guardado como veio da fonte
+		t.Errorf("rejeitado guardado = %+v, esperado o original %+v", got, orders[1])
+	}
+}
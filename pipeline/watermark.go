@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Modos de ingestão aceitos em POST /trigger?mode=
+const (
+	modeIncremental = "incremental" // busca apenas pedidos a partir do watermark salvo
+	modeFull        = "full"        // ignora o watermark e busca todos os pedidos
+)
+
+// setupWatermarkTable cria a tabela que guarda o maior created_at já ingerido por fonte
+func setupWatermarkTable(db *sql.DB) error {
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS pipeline.watermarks (
+			source VARCHAR(255) PRIMARY KEY,
+			value TIMESTAMPTZ NOT NULL,
+			run_id BIGINT,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return fmt.Errorf("erro ao criar tabela pipeline.watermarks: %w", err)
+	}
+	return nil
+}
+
+// loadWatermark retorna o watermark da fonte, ou o tempo zero se ainda não houver
+func loadWatermark(db *sql.DB, source string) (time.Time, error) {
+	var value time.Time
+	err := db.QueryRow("SELECT value FROM pipeline.watermarks WHERE source = $1", source).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil // primeira execução: carga completa
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("erro ao ler watermark: %w", err)
+	}
+	return value, nil
+}
+
+// saveWatermark avança o watermark da fonte; GREATEST impede que ele volte no tempo
+func saveWatermark(db *sql.DB, source string, value time.Time, runID int64) error {
+	var run sql.NullInt64
+	if runID != 0 {
+		run = sql.NullInt64{Int64: runID, Valid: true}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO pipeline.watermarks (source, value, run_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (source) DO UPDATE SET
+			value = GREATEST(pipeline.watermarks.value, EXCLUDED.value),
+			run_id = EXCLUDED.run_id,
+			updated_at = CURRENT_TIMESTAMP
+	`, source, value, run)
+	if err != nil {
+		return fmt.Errorf("erro ao salvar watermark: %w", err)
+	}
+	return nil
+}
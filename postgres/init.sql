@@ -4,5 +4,8 @@ CREATE SCHEMA IF NOT EXISTS raw_data;
 -- Criar schema para dados agregados
 CREATE SCHEMA IF NOT EXISTS aggregated;
 
+-- Criar schema para controle do pipeline (histórico de execuções)
+CREATE SCHEMA IF NOT EXISTS pipeline;
+
 
 
@@ -1,7 +1,7 @@
 import os
 import psycopg2
 from psycopg2.extras import RealDictCursor
-from flask import Flask, jsonify
+from flask import Flask, jsonify, request
 from flask_cors import CORS
 
 def get_database_connection():
@@ -45,8 +45,19 @@ def setup_aggregated_schema(conn):
         conn.commit()
         print("✅ Schema aggregated e tabela daily_metrics verificados/criados")
 
-def aggregate_data(conn):
-    """Lê dados de raw_data.orders e agrega por data, status e payment_method"""
+def scope_params(keys): # converte os grupos recebidos do pipeline em três arrays paralelos para o unnest
+    return (
+        [k['date'] for k in keys],
+        [k['status'] for k in keys],
+        [k['payment_method'] for k in keys],
+    )
+
+# Grupos tocados pela execução do pipeline, usados para restringir a agregação e a limpeza
+SCOPE_SQL = "(SELECT * FROM unnest(%s::date[], %s::text[], %s::text[]))"
+
+def aggregate_data(conn, keys=None):
+    """Lê dados de raw_data.orders e agrega por data, status e payment_method
+    (apenas os grupos em keys, se informado)"""
     with conn.cursor(cursor_factory=RealDictCursor) as cur: # retorna linhas como dicionários, para o acesso ser dado por nome de coluna, em vez de índice
         # Query de agregação, query é uma consulta SQL que retorna os dados agregados por data, status e payment_method, é uma query de seleção (SELECT)
         aggregation_sql = """
@@ -57,19 +68,24 @@ def aggregate_data(conn):
                 COUNT(*) as total_orders,
                 SUM(value) as total_value
             FROM raw_data.orders
+            {scope}
             GROUP BY DATE(created_at), status, payment_method  -- agrupa os que tem o mesmo date, status e payment_method
             ORDER BY date, status, payment_method  -- ordena por date, status e payment_method
         """
         
-        cur.execute(aggregation_sql) # executa o SQL de agregação
+        if keys is None: # reconstrução completa
+            cur.execute(aggregation_sql.format(scope=""))
+        else: # apenas os grupos tocados pelo pipeline
+            scope = f"WHERE (DATE(created_at), status, payment_method) IN {SCOPE_SQL}"
+            cur.execute(aggregation_sql.format(scope=scope), scope_params(keys))
         aggregated_data = cur.fetchall() # retorna as linhas resultantes da execução do SQL de agregação
         
         print(f"✅ {len(aggregated_data)} grupos de dados agregados encontrados")
         return aggregated_data
 
-def insert_aggregated_data(conn, aggregated_data): # recebe a conexão e os dados agregados e atualiza a tabela aggregated.daily_metrics
+def insert_aggregated_data(conn, aggregated_data, keys=None): # recebe a conexão e os dados agregados e atualiza a tabela aggregated.daily_metrics
     """Insere os dados agregados na tabela aggregated.daily_metrics"""
-    if not aggregated_data:
+    if not aggregated_data and keys is None:
         print("⚠️  Nenhum dado para inserir")
         return 0
     
@@ -104,11 +120,29 @@ def insert_aggregated_data(conn, aggregated_data): # recebe a conexão e os dado
                 print(f"⚠️  Erro ao inserir linha: {e}")
                 continue
         
+        # Remover grupos que deixaram de existir (ex.: pedido que passou de pending para approved no modo upsert do pipeline)
+        # Na agregação incremental, só os grupos tocados são verificados
+        delete_sql = """
+            DELETE FROM aggregated.daily_metrics d
+            WHERE NOT EXISTS (
+                SELECT 1 FROM raw_data.orders o
+                WHERE DATE(o.created_at) = d.date
+                  AND o.status = d.status
+                  AND o.payment_method = d.payment_method
+            )
+        """
+        if keys is None:
+            cur.execute(delete_sql)
+        else:
+            cur.execute(delete_sql + f" AND (d.date, d.status, d.payment_method) IN {SCOPE_SQL}", scope_params(keys))
+        if cur.rowcount > 0:
+            print(f"🧹 {cur.rowcount} grupos sem pedidos removidos")
+
         conn.commit() # confirma a transação, ou seja, insere as linhas na tabela aggregated.daily_metrics. antes disso, ficam como pendentes
         return inserted # retorna o número de linhas inseridas
 
-def run_transformation():
-    """Executa a transformação de dados"""
+def run_transformation(keys=None):
+    """Executa a transformação de dados (incremental se keys for informado)"""
     try:
         # Conectar ao PostgreSQL
         print("\n📡 Conectando ao PostgreSQL...")
@@ -120,12 +154,15 @@ def run_transformation():
         setup_aggregated_schema(conn)
         
         # Agregar dados
-        print("\n📊 Agregando dados de raw_data.orders...")
-        aggregated_data = aggregate_data(conn)
+        if keys is None:
+            print("\n📊 Agregando dados de raw_data.orders...")
+        else:
+            print(f"\n📊 Agregando {len(keys)} grupos de raw_data.orders...")
+        aggregated_data = aggregate_data(conn, keys)
         
         # Inserir dados agregados
         print("\n💾 Inserindo dados agregados em aggregated.daily_metrics...")
-        inserted = insert_aggregated_data(conn, aggregated_data)
+        inserted = insert_aggregated_data(conn, aggregated_data, keys)
         print(f"✅ {inserted} registros inseridos/atualizados com sucesso")
         
         # Fechar conexão com o banco de dados
@@ -156,10 +193,13 @@ def health():
 
 @app.route('/transform', methods=['POST']) #rota post para executar a transformação
 def transform():
-    """Endpoint HTTP para executar a transformação"""
+    """Endpoint HTTP para executar a transformação. Sem corpo, reconstrói todas as métricas;
+    com {"keys": [{"date", "status", "payment_method"}, ...]}, recalcula apenas esses grupos"""
     try:
         print("\n=== Transformação disparada via HTTP ===")
-        inserted = run_transformation() # executa a transformação e retorna o número de linhas inseridas
+        body = request.get_json(silent=True) or {}
+        keys = body.get('keys') # None = reconstrução completa
+        inserted = run_transformation(keys) # executa a transformação e retorna o número de linhas inseridas
         return jsonify({
             'success': True,
             'message': 'Transformação executada com sucesso',